@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+type authCode struct {
+	ClientID      string
+	RedirectURI   string
+	Challenge     string
+	Nonce         string
+	Email         string
+	EmailVerified bool
+	Name          string
+	ExpiresAt     time.Time
+}
+
+type provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+	KeyID        string
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!doctype html>
+<html>
+<head><title>Mock OIDC provider</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 40px auto;">
+    <h2>Mock OIDC provider</h2>
+    <p>Sign in to <strong>{{.ClientID}}</strong> as:</p>
+    <form method="post">
+        {{range $key, $values := .Query}}{{range $values}}<input type="hidden" name="{{$key}}" value="{{.}}">{{end}}{{end}}
+        <p><label>Email<br><input type="email" name="login_email" value="user@example.com" required></label></p>
+        <p><label>Name<br><input type="text" name="login_name" value="Example User"></label></p>
+        <p><label><input type="checkbox" name="login_verified" value="true" checked> Email verified</label></p>
+        <button type="submit" name="decision" value="allow">Sign in</button>
+        <button type="submit" name="decision" value="deny">Deny</button>
+    </form>
+</body>
+</html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL advertised to clients")
+	clientID := flag.String("client-id", "galaria", "accepted client ID")
+	clientSecret := flag.String("client-secret", "galaria-secret", "accepted client secret, empty for public clients")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &provider{
+		Issuer:       strings.TrimSuffix(*issuer, "/"),
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		Key:          key,
+		KeyID:        fmt.Sprintf("mock-%d", time.Now().Unix()),
+		codes:        make(map[string]authCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.Discovery)
+	mux.HandleFunc("GET /authorize", p.Authorize)
+	mux.HandleFunc("POST /authorize", p.ProcessAuthorize)
+	mux.HandleFunc("POST /token", p.Token)
+	mux.HandleFunc("GET /jwks", p.JWKS)
+
+	fmt.Printf("Mock OIDC provider %s listening on %s\n", p.Issuer, *addr)
+	err = http.ListenAndServe(*addr, mux)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (p *provider) Discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+func (p *provider) Authorize(w http.ResponseWriter, r *http.Request) {
+	err := p.validateAuthorize(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	authorizeTemplate.Execute(w, map[string]any{
+		"ClientID": p.ClientID,
+		"Query":    r.URL.Query(),
+	})
+}
+
+func (p *provider) ProcessAuthorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = p.validateAuthorize(r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirect, _ := url.Parse(r.PostForm.Get("redirect_uri"))
+	vals := redirect.Query()
+	vals.Set("state", r.PostForm.Get("state"))
+
+	if r.PostForm.Get("decision") != "allow" {
+		vals.Set("error", "access_denied")
+		vals.Set("error_description", "The user denied the request")
+		redirect.RawQuery = vals.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+		return
+	}
+
+	code, err := rand.String(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		ClientID:      r.PostForm.Get("client_id"),
+		RedirectURI:   r.PostForm.Get("redirect_uri"),
+		Challenge:     r.PostForm.Get("code_challenge"),
+		Nonce:         r.PostForm.Get("nonce"),
+		Email:         strings.ToLower(r.PostForm.Get("login_email")),
+		EmailVerified: r.PostForm.Get("login_verified") == "true",
+		Name:          r.PostForm.Get("login_name"),
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	vals.Set("code", code)
+	redirect.RawQuery = vals.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *provider) validateAuthorize(vals url.Values) error {
+	switch {
+	case vals.Get("response_type") != "code":
+		return fmt.Errorf("unsupported response_type %q", vals.Get("response_type"))
+	case vals.Get("client_id") != p.ClientID:
+		return fmt.Errorf("unknown client_id %q", vals.Get("client_id"))
+	case !strings.Contains(" "+vals.Get("scope")+" ", " openid "):
+		return fmt.Errorf("the openid scope is required")
+	case vals.Get("code_challenge") == "" || vals.Get("code_challenge_method") != "S256":
+		return fmt.Errorf("PKCE with S256 is required")
+	}
+
+	redirect, err := url.Parse(vals.Get("redirect_uri"))
+	if err != nil || !redirect.IsAbs() {
+		return fmt.Errorf("invalid redirect_uri %q", vals.Get("redirect_uri"))
+	}
+
+	return nil
+}
+
+func (p *provider) Token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID != p.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.ClientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mockoidc"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(code.ExpiresAt) || code.ClientID != clientID {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+
+	if code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != code.Challenge {
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	idToken, err := p.sign(code)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	accessToken, err := rand.String(32)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *provider) JWKS(w http.ResponseWriter, r *http.Request) {
+	pub := p.Key.PublicKey
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *provider) sign(code authCode) (string, error) {
+	now := time.Now()
+	subject := sha256.Sum256([]byte(code.Email))
+
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": p.KeyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iss":            p.Issuer,
+		"sub":            hex.EncodeToString(subject[:16]),
+		"aud":            code.ClientID,
+		"azp":            code.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          code.Nonce,
+		"email":          code.Email,
+		"email_verified": code.EmailVerified,
+		"name":           code.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(nil, p.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
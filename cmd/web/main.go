@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexandru-calin/galaria/controllers"
 	"github.com/alexandru-calin/galaria/migrations"
@@ -24,7 +29,35 @@ type config struct {
 		Secure bool
 	}
 	Server struct {
-		Address string
+		Address        string
+		TrustedProxies []netip.Prefix
+	}
+	Images struct {
+		ReEncode   bool
+		MaxPixels  int
+		Renditions []string
+		Quota      models.Quota
+	}
+	Trash struct {
+		Retention time.Duration
+	}
+	Events struct {
+		Backend string
+		Channel string
+	}
+	RateLimit struct {
+		Backend string
+	}
+	OIDC struct {
+		Providers []*models.OIDCProvider
+	}
+	Passwords struct {
+		MinLength    int
+		MaxBytes     int
+		BreachedFile string
+		Hasher       string
+		BcryptCost   int
+		Argon2       models.Argon2idHasher
 	}
 }
 
@@ -57,10 +90,172 @@ func loadEnvConfig() (config, error) {
 	cfg.CSRF.Secure = os.Getenv("CSRF_SECURE") == "true"
 
 	cfg.Server.Address = os.Getenv("SERVER_ADDRESS")
+	cfg.Server.TrustedProxies, err = controllers.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return cfg, fmt.Errorf("parsing TRUSTED_PROXIES: %w", err)
+	}
+
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		cfg.Trash.Retention, err = time.ParseDuration(retention)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing TRASH_RETENTION: %w", err)
+		}
+	}
+
+	cfg.Events.Backend = os.Getenv("EVENTS_BACKEND")
+	cfg.Events.Channel = os.Getenv("EVENTS_CHANNEL")
+
+	cfg.RateLimit.Backend = os.Getenv("RATELIMIT_BACKEND")
+
+	cfg.OIDC.Providers, err = loadOIDCProviders(os.Getenv("OIDC_PROVIDERS"))
+	if err != nil {
+		return cfg, err
+	}
+
+	if minLength := os.Getenv("PASSWORD_MIN_LENGTH"); minLength != "" {
+		cfg.Passwords.MinLength, err = strconv.Atoi(minLength)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing PASSWORD_MIN_LENGTH: %w", err)
+		}
+	}
+
+	if maxBytes := os.Getenv("PASSWORD_MAX_BYTES"); maxBytes != "" {
+		cfg.Passwords.MaxBytes, err = strconv.Atoi(maxBytes)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing PASSWORD_MAX_BYTES: %w", err)
+		}
+	}
+
+	cfg.Passwords.BreachedFile = os.Getenv("PASSWORD_BREACHED_FILE")
+	cfg.Passwords.Hasher = os.Getenv("PASSWORD_HASHER")
+
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		cfg.Passwords.BcryptCost, err = strconv.Atoi(cost)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing BCRYPT_COST: %w", err)
+		}
+	}
+
+	if memory := os.Getenv("ARGON2_MEMORY"); memory != "" {
+		value, err := strconv.ParseUint(memory, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing ARGON2_MEMORY: %w", err)
+		}
+		cfg.Passwords.Argon2.Memory = uint32(value)
+	}
+
+	if iterations := os.Getenv("ARGON2_TIME"); iterations != "" {
+		value, err := strconv.ParseUint(iterations, 10, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing ARGON2_TIME: %w", err)
+		}
+		cfg.Passwords.Argon2.Time = uint32(value)
+	}
+
+	if threads := os.Getenv("ARGON2_THREADS"); threads != "" {
+		value, err := strconv.ParseUint(threads, 10, 8)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing ARGON2_THREADS: %w", err)
+		}
+		cfg.Passwords.Argon2.Threads = uint8(value)
+	}
+
+	cfg.Images.ReEncode = os.Getenv("IMAGES_REENCODE") != "false"
+	if maxPixels := os.Getenv("IMAGES_MAX_PIXELS"); maxPixels != "" {
+		cfg.Images.MaxPixels, err = strconv.Atoi(maxPixels)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing IMAGES_MAX_PIXELS: %w", err)
+		}
+	}
+
+	if renditions, ok := os.LookupEnv("IMAGES_RENDITIONS"); ok {
+		cfg.Images.Renditions = []string{}
+		for _, format := range strings.Split(renditions, ",") {
+			format = strings.TrimSpace(format)
+			if format == "" {
+				continue
+			}
+
+			contentType := "image/" + format
+			if !models.ValidRendition(contentType) {
+				return cfg, fmt.Errorf("parsing IMAGES_RENDITIONS: unsupported format %q", format)
+			}
+			cfg.Images.Renditions = append(cfg.Images.Renditions, contentType)
+		}
+	}
+
+	if quotaBytes := os.Getenv("QUOTA_BYTES"); quotaBytes != "" {
+		cfg.Images.Quota.Bytes, err = strconv.ParseInt(quotaBytes, 10, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing QUOTA_BYTES: %w", err)
+		}
+	}
+
+	if quotaImages := os.Getenv("QUOTA_IMAGES"); quotaImages != "" {
+		cfg.Images.Quota.Images, err = strconv.Atoi(quotaImages)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing QUOTA_IMAGES: %w", err)
+		}
+	}
 
 	return cfg, nil
 }
 
+func loadOIDCProviders(names string) ([]*models.OIDCProvider, error) {
+	var providers []*models.OIDCProvider
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if !validProviderName(name) {
+			return nil, fmt.Errorf("parsing OIDC_PROVIDERS: invalid provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := &models.OIDCProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			Signup:       os.Getenv(prefix+"SIGNUP") == "true",
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return nil, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+
+		redirect, err := url.Parse(provider.RedirectURL)
+		if err != nil || !redirect.IsAbs() || redirect.Path != "/oidc/"+name+"/callback" {
+			return nil, fmt.Errorf("%sREDIRECT_URL must be an absolute URL ending in /oidc/%s/callback", prefix, name)
+		}
+
+		if provider.DisplayName == "" {
+			provider.DisplayName = name
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+func validProviderName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
+
 func main() {
 	cfg, err := loadEnvConfig()
 	if err != nil {
@@ -91,9 +286,64 @@ func run(cfg config) error {
 		return err
 	}
 
+	// Setup events
+	var imageEvents models.ImageEvents
+
+	switch cfg.Events.Backend {
+	case "", "memory":
+		imageEvents = models.NewLocalImageEvents()
+	case "postgres":
+		postgresEvents := models.NewPostgresImageEvents(db, cfg.Events.Channel)
+		go postgresEvents.Listen(context.Background(), 5*time.Second)
+		imageEvents = postgresEvents
+	default:
+		return fmt.Errorf("unknown EVENTS_BACKEND %q", cfg.Events.Backend)
+	}
+
+	// Setup rate limiting
+	var rateLimiter models.RateLimiter
+
+	switch cfg.RateLimit.Backend {
+	case "", "memory":
+		rateLimiter = models.NewLocalRateLimiter()
+	case "postgres":
+		rateLimiter = &models.PostgresRateLimiter{
+			DB: db,
+		}
+	default:
+		return fmt.Errorf("unknown RATELIMIT_BACKEND %q", cfg.RateLimit.Backend)
+	}
+
+	go sweepRateLimits(rateLimiter, 24*time.Hour, 10*time.Minute)
+
 	// Setup services
+	passwordPolicy := models.PasswordPolicy{
+		MinLength: cfg.Passwords.MinLength,
+		MaxBytes:  cfg.Passwords.MaxBytes,
+	}
+	if cfg.Passwords.BreachedFile != "" {
+		passwordPolicy.Breached, err = models.LoadBreachedPasswords(cfg.Passwords.BreachedFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %d breached password hashes\n", passwordPolicy.Breached.Len())
+	}
+
+	var passwordHasher models.PasswordHasher
+
+	switch cfg.Passwords.Hasher {
+	case "", "argon2id":
+		passwordHasher = cfg.Passwords.Argon2
+	case "bcrypt":
+		passwordHasher = models.BcryptHasher{Cost: cfg.Passwords.BcryptCost}
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASHER %q", cfg.Passwords.Hasher)
+	}
+
 	userService := &models.UserService{
-		DB: db,
+		DB:     db,
+		Policy: passwordPolicy,
+		Hasher: passwordHasher,
 	}
 	sessionService := &models.SessionService{
 		DB: db,
@@ -102,14 +352,66 @@ func run(cfg config) error {
 		DB: db,
 	}
 	galleryService := &models.GalleryService{
+		DB:             db,
+		ReEncode:       cfg.Images.ReEncode,
+		MaxPixels:      cfg.Images.MaxPixels,
+		Renditions:     cfg.Images.Renditions,
+		DefaultQuota:   cfg.Images.Quota,
+		TrashRetention: cfg.Trash.Retention,
+		Events:         imageEvents,
+	}
+	memberService := &models.MemberService{
+		DB: db,
+	}
+	organizationService := &models.OrganizationService{
+		DB: db,
+	}
+	uploadLinkService := &models.UploadLinkService{
+		DB: db,
+	}
+	proofingService := &models.ProofingService{
+		DB: db,
+	}
+	commentService := &models.CommentService{
+		DB:         db,
+		RateLimit:  models.DefaultCommentRateLimit,
+		RateWindow: models.DefaultCommentRateWindow,
+	}
+	favoriteService := &models.FavoriteService{
+		DB: db,
+	}
+	followService := &models.FollowService{
+		DB: db,
+	}
+	emailChangeService := &models.EmailChangeService{
+		DB: db,
+	}
+	loginLinkService := &models.LoginLinkService{
+		DB: db,
+	}
+	identityService := &models.IdentityService{
 		DB: db,
 	}
 	emailService := models.NewEmailService(cfg.SMTP)
 
+	err = galleryService.ImportLegacyImages()
+	if err != nil {
+		return err
+	}
+
+	go sweepTrash(galleryService, time.Hour)
+	go sweepBlobs(galleryService, models.DefaultBlobGracePeriod, time.Hour)
+
 	// Setup middleware
 	umw := controllers.UserMiddleware{
 		SessionService: sessionService,
 	}
+	pmw := controllers.ProxyMiddleware{
+		TrustedProxies: cfg.Server.TrustedProxies,
+	}
+	omw := controllers.OrganizationMiddleware{
+		OrganizationService: organizationService,
+	}
 
 	csrfMw := csrf.Protect(
 		[]byte(cfg.CSRF.Key),
@@ -124,6 +426,13 @@ func run(cfg config) error {
 		SessionService:       sessionService,
 		PasswordResetService: passwordResetService,
 		EmailService:         emailService,
+		OrganizationService:  organizationService,
+		FollowService:        followService,
+		EmailChangeService:   emailChangeService,
+		LoginLinkService:     loginLinkService,
+		IdentityService:      identityService,
+		OIDCProviders:        cfg.OIDC.Providers,
+		RateLimiter:          rateLimiter,
 	}
 	usersC.Templates.Home = views.Must(views.ParseFS(ui.FS, "base.html", "home.html"))
 	usersC.Templates.New = views.Must(views.ParseFS(ui.FS, "base.html", "users/register.html"))
@@ -131,22 +440,45 @@ func run(cfg config) error {
 	usersC.Templates.ForgotPassword = views.Must(views.ParseFS(ui.FS, "base.html", "users/password-forgot.html"))
 	usersC.Templates.CheckYourEmail = views.Must(views.ParseFS(ui.FS, "base.html", "users/check-your-email.html"))
 	usersC.Templates.ResetPassword = views.Must(views.ParseFS(ui.FS, "base.html", "users/password-reset.html"))
+	usersC.Templates.EmailChange = views.Must(views.ParseFS(ui.FS, "base.html", "users/email-change.html"))
 	usersC.Templates.Me = views.Must(views.ParseFS(ui.FS, "base.html", "users/me.html"))
+	usersC.Templates.Profile = views.Must(views.ParseFS(ui.FS, "base.html", "users/profile.html"))
 
 	galleriesC := controllers.Galleries{
-		GalleryService: galleryService,
+		GalleryService:      galleryService,
+		MemberService:       memberService,
+		OrganizationService: organizationService,
+		UploadLinkService:   uploadLinkService,
+		ProofingService:     proofingService,
+		CommentService:      commentService,
+		FavoriteService:     favoriteService,
+		EmailService:        emailService,
+		RateLimiter:         rateLimiter,
 	}
 	galleriesC.Templates.New = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/new.html"))
 	galleriesC.Templates.Edit = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/edit.html"))
 	galleriesC.Templates.Index = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/index.html"))
 	galleriesC.Templates.Show = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/show.html"))
+	galleriesC.Templates.Trash = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/trash.html"))
+	galleriesC.Templates.Upload = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/upload.html"))
+	galleriesC.Templates.Slideshow = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/slideshow.html"))
+	galleriesC.Templates.Favorites = views.Must(views.ParseFS(ui.FS, "base.html", "galleries/favorites.html"))
+
+	organizationsC := controllers.Organizations{
+		OrganizationService: organizationService,
+		EmailService:        emailService,
+	}
+	organizationsC.Templates.Index = views.Must(views.ParseFS(ui.FS, "base.html", "organizations/index.html"))
+	organizationsC.Templates.Show = views.Must(views.ParseFS(ui.FS, "base.html", "organizations/show.html"))
 
 	// Setup router and routes
 	r := chi.NewRouter()
 
+	r.Use(pmw.SetRealIP)
 	r.Use(csrfMw)
 	r.Use(umw.SetTheme)
 	r.Use(umw.SetUser)
+	r.Use(omw.SetWorkspace)
 
 	assetsHandler := http.FileServer(http.Dir("assets"))
 
@@ -155,6 +487,8 @@ func run(cfg config) error {
 	r.Get("/register", usersC.New)
 	r.Get("/login", usersC.Login)
 	r.Post("/login", usersC.ProcessLogin)
+	r.Get("/login/link", usersC.LoginWithLink)
+	r.Post("/login/link", usersC.ProcessLoginLink)
 	r.Post("/logout", usersC.ProcessLogout)
 	r.Get("/forgot-password", usersC.ForgotPassword)
 	r.Post("/forgot-password", usersC.ProcessForgotPassword)
@@ -163,14 +497,40 @@ func run(cfg config) error {
 	r.Post("/change-theme", usersC.ChangeTheme)
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", usersC.Create)
+		r.Get("/email/confirm", usersC.ConfirmEmailChange)
+		r.Post("/email/confirm", usersC.ProcessConfirmEmailChange)
+		r.Get("/email/revert", usersC.RevertEmailChange)
+		r.Post("/email/revert", usersC.ProcessRevertEmailChange)
 		r.Group(func(r chi.Router) {
 			r.Use(umw.RequireUser)
 			r.Get("/me", usersC.Me)
+			r.Post("/me/profile", usersC.UpdateProfile)
+			r.Post("/me/avatar", usersC.UploadAvatar)
+			r.Post("/me/avatar/delete", usersC.DeleteAvatar)
+			r.Post("/me/email", usersC.ChangeEmail)
+			r.Post("/me/password", usersC.ChangePassword)
+			r.Post("/me/identities/{provider}/delete", usersC.UnlinkIdentity)
 			r.Post("/me/delete", usersC.Delete)
 		})
 	})
+	r.Route("/oidc/{provider}", func(r chi.Router) {
+		r.Get("/login", usersC.OIDCLogin)
+		r.Get("/callback", usersC.OIDCCallback)
+		r.With(umw.RequireUser).Post("/link", usersC.OIDCLink)
+	})
+	r.Route("/u/{handle}", func(r chi.Router) {
+		r.Get("/", usersC.Profile)
+		r.Get("/avatar", usersC.Avatar)
+		r.Group(func(r chi.Router) {
+			r.Use(umw.RequireUser)
+			r.Post("/follow", usersC.Follow)
+			r.Post("/unfollow", usersC.Unfollow)
+		})
+	})
 	r.Route("/galleries", func(r chi.Router) {
 		r.Get("/{id}", galleriesC.Show)
+		r.Get("/{id}/slideshow", galleriesC.Slideshow)
+		r.Get("/{id}/events", galleriesC.Events)
 		r.Get("/{id}/images/{filename}", galleriesC.Image)
 		r.Group(func(r chi.Router) {
 			r.Use(umw.RequireUser)
@@ -180,12 +540,106 @@ func run(cfg config) error {
 			r.Get("/{id}/edit", galleriesC.Edit)
 			r.Post("/{id}", galleriesC.Update)
 			r.Post("/{id}/images", galleriesC.UploadImage)
+			r.Post("/{id}/images/bulk", galleriesC.BulkImages)
+			r.Post("/{id}/duplicate", galleriesC.Duplicate)
+			r.Post("/{id}/transfer", galleriesC.Transfer)
 			r.Post("/{id}/delete", galleriesC.Delete)
+			r.Get("/{id}/images/{filename}/original", galleriesC.Original)
 			r.Post("/{id}/images/{filename}/delete", galleriesC.DeleteImage)
+			r.Post("/{id}/members", galleriesC.InviteMember)
+			r.Post("/{id}/members/{userID}", galleriesC.UpdateMember)
+			r.Post("/{id}/members/{userID}/delete", galleriesC.RemoveMember)
+			r.Post("/{id}/invitations/{invitationID}/delete", galleriesC.RevokeInvitation)
+			r.Post("/{id}/upload-links", galleriesC.CreateUploadLink)
+			r.Post("/{id}/upload-links/{linkID}/delete", galleriesC.DeleteUploadLink)
+			r.Post("/{id}/proofing", galleriesC.UpdateProofing)
+			r.Post("/{id}/proofing/submit", galleriesC.SubmitProofing)
+			r.Get("/{id}/proofing/{selectionID}/export", galleriesC.ExportProofing)
+			r.Post("/{id}/proofing/images/{filename}", galleriesC.SelectProof)
+			r.Post("/{id}/proofing/images/{filename}/delete", galleriesC.DeselectProof)
+			r.Post("/{id}/comments", galleriesC.CreateComment)
+			r.Post("/{id}/comments/mode", galleriesC.UpdateCommentMode)
+			r.Post("/{id}/comments/{commentID}/approve", galleriesC.ApproveComment)
+			r.Post("/{id}/comments/{commentID}/delete", galleriesC.DeleteComment)
+			r.Post("/{id}/favorite", galleriesC.FavoriteGallery)
+			r.Post("/{id}/unfavorite", galleriesC.UnfavoriteGallery)
+			r.Post("/{id}/images/{filename}/favorite", galleriesC.FavoriteImage)
+			r.Post("/{id}/images/{filename}/unfavorite", galleriesC.UnfavoriteImage)
 		})
 	})
 
+	r.Route("/organizations", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", organizationsC.Index)
+		r.Post("/", organizationsC.Create)
+		r.Get("/invitations/accept", organizationsC.AcceptInvitation)
+		r.Get("/{id}", organizationsC.Show)
+		r.Post("/{id}", organizationsC.Update)
+		r.Post("/{id}/delete", organizationsC.Delete)
+		r.Post("/{id}/members", organizationsC.Invite)
+		r.Post("/{id}/members/{userID}", organizationsC.UpdateMember)
+		r.Post("/{id}/members/{userID}/delete", organizationsC.RemoveMember)
+		r.Post("/{id}/invitations/{invitationID}/delete", organizationsC.RevokeInvitation)
+	})
+
+	r.With(umw.RequireUser).Post("/workspace", organizationsC.SwitchWorkspace)
+
+	r.Route("/invitations", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/accept", galleriesC.AcceptInvitation)
+	})
+
+	r.Get("/upload/{token}", galleriesC.GuestUpload)
+	r.Post("/upload/{token}", galleriesC.ProcessGuestUpload)
+
+	r.With(umw.RequireUser).Get("/favorites", galleriesC.Favorites)
+	r.Route("/trash", func(r chi.Router) {
+		r.Use(umw.RequireUser)
+		r.Get("/", galleriesC.Trash)
+		r.Post("/galleries/{id}/restore", galleriesC.RestoreGallery)
+		r.Post("/galleries/{id}/purge", galleriesC.PurgeGallery)
+		r.Post("/galleries/{id}/images/{filename}/restore", galleriesC.RestoreImage)
+		r.Post("/galleries/{id}/images/{filename}/purge", galleriesC.PurgeImage)
+	})
+
 	// Start server
 	fmt.Printf("Starting the server on %s\n", cfg.Server.Address)
 	return http.ListenAndServe(cfg.Server.Address, r)
 }
+
+func sweepTrash(gs *models.GalleryService, interval time.Duration) {
+	for {
+		n, err := gs.PurgeExpired()
+		if err != nil {
+			fmt.Println(err)
+		} else if n > 0 {
+			fmt.Printf("Purged %d expired items from the trash\n", n)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func sweepBlobs(gs *models.GalleryService, grace, interval time.Duration) {
+	for {
+		n, err := gs.SweepBlobs(grace)
+		if err != nil {
+			fmt.Println(err)
+		} else if n > 0 {
+			fmt.Printf("Removed %d unreferenced blob files\n", n)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func sweepRateLimits(rl models.RateLimiter, maxAge, interval time.Duration) {
+	for {
+		err := rl.Sweep(maxAge)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestLoadOIDCProviders(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURL string
+		wantErr     bool
+	}{
+		{"redirect url set", "https://galaria.test/oidc/corp-sso/callback", false},
+		{"redirect url missing", "", true},
+		{"relative redirect url", "/oidc/corp-sso/callback", true},
+		{"redirect url for another provider", "https://galaria.test/oidc/other/callback", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OIDC_CORP_SSO_ISSUER", "https://sso.example.com")
+			t.Setenv("OIDC_CORP_SSO_CLIENT_ID", "galaria")
+			t.Setenv("OIDC_CORP_SSO_REDIRECT_URL", tt.redirectURL)
+
+			providers, err := loadOIDCProviders("corp-sso")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadOIDCProviders() err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && providers[0].RedirectURL != tt.redirectURL {
+				t.Errorf("RedirectURL = %q, want %q", providers[0].RedirectURL, tt.redirectURL)
+			}
+		})
+	}
+}
+
+func TestLoadOIDCProvidersInvalidName(t *testing.T) {
+	_, err := loadOIDCProviders("Corp SSO")
+	if err == nil {
+		t.Errorf("loadOIDCProviders() err = nil, want an invalid name error")
+	}
+}
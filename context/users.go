@@ -2,6 +2,7 @@ package context
 
 import (
 	"context"
+	"sync"
 
 	"github.com/alexandru-calin/galaria/models"
 )
@@ -9,8 +10,9 @@ import (
 type key string
 
 const (
-	userKey  key = "user"
-	themeKey key = "theme"
+	userKey      key = "user"
+	themeKey     key = "theme"
+	workspaceKey key = "workspace"
 )
 
 func WithUser(ctx context.Context, user *models.User) context.Context {
@@ -42,3 +44,20 @@ func Theme(ctx context.Context) string {
 
 	return theme
 }
+
+// WithWorkspace stores a function loading the workspace, so requests that
+// never read it don't pay for the lookup. The function is called at most once.
+func WithWorkspace(ctx context.Context, load func() *models.Workspace) context.Context {
+	return context.WithValue(ctx, workspaceKey, sync.OnceValue(load))
+}
+
+func Workspace(ctx context.Context) *models.Workspace {
+	val := ctx.Value(workspaceKey)
+
+	load, ok := val.(func() *models.Workspace)
+	if !ok {
+		return &models.Workspace{}
+	}
+
+	return load()
+}
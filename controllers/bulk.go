@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+)
+
+type bulkRequest struct {
+	Action    string   `json:"action"`
+	Filenames []string `json:"filenames"`
+	GalleryID int      `json:"gallery_id"`
+	Tags      string   `json:"tags"`
+	Caption   string   `json:"caption"`
+	Rating    int      `json:"rating"`
+	Flag      string   `json:"flag"`
+	Label     string   `json:"label"`
+}
+
+type bulkResult struct {
+	Action  string `json:"action"`
+	Images  int    `json:"images"`
+	Message string `json:"message"`
+}
+
+var bulkRoles = map[string]models.Role{
+	"delete":   models.RoleEditor,
+	"tag":      models.RoleEditor,
+	"caption":  models.RoleEditor,
+	"move":     models.RoleOwner,
+	"copy":     models.RoleEditor,
+	"download": models.RoleOwner,
+	"approve":  models.RoleEditor,
+	"reject":   models.RoleEditor,
+	"rate":     models.RoleOwner,
+	"flag":     models.RoleOwner,
+	"label":    models.RoleOwner,
+}
+
+func (g Galleries) BulkImages(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	req, err := parseBulkRequest(r)
+	if err != nil {
+		bulkError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	role, ok := bulkRoles[req.Action]
+	if !ok {
+		bulkError(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+
+	err = g.requireRole(role)(w, r, gallery)
+	if err != nil {
+		return
+	}
+
+	if len(req.Filenames) == 0 {
+		bulkError(w, r, http.StatusBadRequest, "No images selected")
+		return
+	}
+
+	result := bulkResult{
+		Action: req.Action,
+		Images: len(req.Filenames),
+	}
+
+	switch req.Action {
+	case "delete":
+		err = g.GalleryService.DeleteImages(gallery.ID, req.Filenames)
+		result.Message = fmt.Sprintf("Moved %d images to trash", result.Images)
+
+	case "tag":
+		var tags []string
+		tags, err = models.ParseTags(req.Tags)
+		if err == nil {
+			err = g.GalleryService.TagImages(gallery.ID, req.Filenames, tags)
+		}
+		result.Message = fmt.Sprintf("Tagged %d images with %s", result.Images, strings.Join(tags, ", "))
+
+	case "caption":
+		err = g.GalleryService.CaptionImages(gallery.ID, req.Filenames, req.Caption)
+		result.Message = fmt.Sprintf("Captioned %d images", result.Images)
+
+	case "move", "copy":
+		target, ok := g.bulkTarget(w, r, req.GalleryID)
+		if !ok {
+			return
+		}
+
+		if req.Action == "move" {
+			err = g.GalleryService.MoveImages(gallery.ID, target.ID, req.Filenames)
+			result.Message = fmt.Sprintf("Moved %d images to %s", result.Images, target.Title)
+		} else {
+			err = g.GalleryService.CopyImages(gallery.ID, target.ID, req.Filenames)
+			result.Message = fmt.Sprintf("Copied %d images to %s", result.Images, target.Title)
+		}
+
+	case "approve":
+		err = g.GalleryService.ApproveImages(gallery.ID, req.Filenames)
+		result.Message = fmt.Sprintf("Approved %d images", result.Images)
+
+	case "reject":
+		err = g.GalleryService.RejectImages(gallery.ID, req.Filenames)
+		result.Message = fmt.Sprintf("Rejected %d images", result.Images)
+
+	case "rate":
+		err = g.GalleryService.RateImages(gallery.ID, req.Filenames, req.Rating)
+		result.Message = fmt.Sprintf("Rated %d images with %d stars", result.Images, req.Rating)
+
+	case "flag":
+		var flag models.Flag
+		flag, err = models.ParseFlag(req.Flag)
+		if err == nil {
+			err = g.GalleryService.FlagImages(gallery.ID, req.Filenames, flag)
+		}
+		result.Message = fmt.Sprintf("Updated the flag of %d images", result.Images)
+
+	case "label":
+		var label models.Label
+		label, err = models.ParseLabel(req.Label)
+		if err == nil {
+			err = g.GalleryService.LabelImages(gallery.ID, req.Filenames, label)
+		}
+		result.Message = fmt.Sprintf("Updated the colour label of %d images", result.Images)
+
+	case "download":
+		g.downloadImages(w, r, gallery, req.Filenames)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			bulkError(w, r, http.StatusNotFound, "One or more images could not be found")
+
+		case errors.Is(err, models.ErrQuotaExceeded):
+			bulkError(w, r, http.StatusForbidden, "This would exceed your storage quota")
+
+		case errors.Is(err, models.ErrInvalidTag):
+			bulkError(w, r, http.StatusBadRequest, fmt.Sprintf("Tags must be comma separated and at most %d characters long", models.MaxTagLength))
+
+		case errors.Is(err, models.ErrCaptionTooLong):
+			bulkError(w, r, http.StatusBadRequest, fmt.Sprintf("Captions can be at most %d characters long", models.MaxCaptionLength))
+
+		case errors.Is(err, models.ErrInvalidRating):
+			bulkError(w, r, http.StatusBadRequest, "Ratings must be between 0 and 5 stars")
+
+		case errors.Is(err, models.ErrInvalidFlag):
+			bulkError(w, r, http.StatusBadRequest, "Flags must be pick, reject or none")
+
+		case errors.Is(err, models.ErrInvalidLabel):
+			bulkError(w, r, http.StatusBadRequest, "Unknown colour label")
+
+		default:
+			fmt.Println(err)
+			bulkError(w, r, http.StatusInternalServerError, "Oops, something went wrong...")
+		}
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	setCookie(w, CookieFlash, result.Message)
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) bulkTarget(w http.ResponseWriter, r *http.Request, id int) (*models.Gallery, bool) {
+	target, err := g.GalleryService.ByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			bulkError(w, r, http.StatusBadRequest, "Invalid target gallery")
+			return nil, false
+		}
+
+		fmt.Println(err)
+		bulkError(w, r, http.StatusInternalServerError, "Oops, something went wrong...")
+		return nil, false
+	}
+
+	err = g.requireRole(models.RoleContributor)(w, r, target)
+	if err != nil {
+		return nil, false
+	}
+
+	return target, true
+}
+
+func (g Galleries) downloadImages(w http.ResponseWriter, r *http.Request, gallery *models.Gallery, filenames []string) {
+	var images []models.Image
+
+	canModerate := g.hasRole(r, gallery, models.RoleEditor)
+
+	for _, filename := range filenames {
+		image, err := g.GalleryService.Image(gallery.ID, filename)
+		if err == nil && image.Pending && !canModerate {
+			err = models.ErrNotFound
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				bulkError(w, r, http.StatusNotFound, "One or more images could not be found")
+				return
+			}
+
+			fmt.Println(err)
+			bulkError(w, r, http.StatusInternalServerError, "Oops, something went wrong...")
+			return
+		}
+
+		images = append(images, image)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gallery-%d.zip"`, gallery.ID))
+
+	zw := zip.NewWriter(w)
+	defer zw.Close()
+
+	for _, image := range images {
+		err := addToZip(zw, image)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+}
+
+func addToZip(zw *zip.Writer, image models.Image) error {
+	path := image.OriginalPath
+	if path == "" {
+		path = image.Path
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("adding %v to zip: %w", image.Filename, err)
+	}
+	defer f.Close()
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     image.Filename,
+		Method:   zip.Store,
+		Modified: image.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("adding %v to zip: %w", image.Filename, err)
+	}
+
+	_, err = io.Copy(dst, f)
+	if err != nil {
+		return fmt.Errorf("adding %v to zip: %w", image.Filename, err)
+	}
+
+	return nil
+}
+
+func parseBulkRequest(r *http.Request) (*bulkRequest, error) {
+	var req bulkRequest
+
+	if hasJSONBody(r) {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			return nil, fmt.Errorf("parsing bulk request: %w", err)
+		}
+	} else {
+		err := r.ParseForm()
+		if err != nil {
+			return nil, fmt.Errorf("parsing bulk request: %w", err)
+		}
+
+		req.Action = r.PostForm.Get("action")
+		req.Filenames = r.PostForm["filenames"]
+		req.Tags = r.PostForm.Get("tags")
+		req.Caption = r.PostForm.Get("caption")
+		req.Flag = r.PostForm.Get("flag")
+		req.Label = r.PostForm.Get("label")
+
+		req.GalleryID, _ = strconv.Atoi(r.PostForm.Get("gallery_id"))
+		req.Rating, _ = strconv.Atoi(r.PostForm.Get("rating"))
+	}
+
+	seen := make(map[string]bool, len(req.Filenames))
+	filenames := req.Filenames[:0]
+
+	for _, filename := range req.Filenames {
+		filename = filepath.Base(filename)
+		if seen[filename] {
+			continue
+		}
+
+		seen[filename] = true
+		filenames = append(filenames, filename)
+	}
+
+	req.Filenames = filenames
+
+	return &req, nil
+}
+
+func bulkError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+
+	http.Error(w, msg, status)
+}
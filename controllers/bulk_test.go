@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBulkRequestFilenames(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []string
+	}{
+		{"form", "application/x-www-form-urlencoded",
+			"action=delete&filenames=a.jpg&filenames=b.jpg", []string{"a.jpg", "b.jpg"}},
+		{"form duplicates", "application/x-www-form-urlencoded",
+			"action=delete&filenames=a.jpg&filenames=b.jpg&filenames=a.jpg", []string{"a.jpg", "b.jpg"}},
+		{"form paths", "application/x-www-form-urlencoded",
+			"action=delete&filenames=../../etc/a.jpg&filenames=a.jpg", []string{"a.jpg"}},
+		{"json", "application/json",
+			`{"action":"delete","filenames":["b.jpg","a.jpg"]}`, []string{"b.jpg", "a.jpg"}},
+		{"json duplicates", "application/json",
+			`{"action":"delete","filenames":["b.jpg","a.jpg","b.jpg","dir/a.jpg"]}`, []string{"b.jpg", "a.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/galleries/1/images/bulk", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			req, err := parseBulkRequest(r)
+			if err != nil {
+				t.Fatalf("parseBulkRequest: %v", err)
+			}
+
+			if !reflect.DeepEqual(req.Filenames, tt.want) {
+				t.Errorf("Filenames = %q, want %q", req.Filenames, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) CreateComment(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	if gallery.Comments == models.CommentsDisabled {
+		http.Error(w, "Comments are disabled for this gallery", http.StatusForbidden)
+		return
+	}
+
+	user := context.User(r.Context())
+	isOwner := g.hasRole(r, gallery, models.RoleOwner)
+	approved := gallery.Comments == models.CommentsOpen || isOwner
+
+	filename := r.FormValue("filename")
+	if filename != "" {
+		filename = filepath.Base(filename)
+	}
+
+	comment, err := g.CommentService.Create(gallery.ID, filename, user.ID, r.FormValue("body"), approved)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidComment):
+			msg := fmt.Sprintf("Comments must be between 1 and %d characters long", models.MaxCommentLength)
+			http.Error(w, msg, http.StatusBadRequest)
+		case errors.Is(err, models.ErrCommentRateLimited):
+			w.Header().Set("Retry-After", strconv.Itoa(int(g.CommentService.Window().Seconds())))
+			http.Error(w, "You are commenting too quickly, please try again later", http.StatusTooManyRequests)
+		case errors.Is(err, models.ErrNotFound):
+			http.NotFound(w, r)
+		default:
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !isOwner {
+		owners, err := g.MemberService.OwnerEmails(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		commentURL := fmt.Sprintf("https://www.galaria.com/galleries/%d#comment-%d", gallery.ID, comment.ID)
+
+		for _, owner := range owners {
+			err = g.EmailService.NewComment(owner, user.Email, gallery.Title, comment.Body, !comment.Approved, commentURL)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+
+	if comment.Approved {
+		setCookie(w, CookieFlash, "Comment posted")
+	} else {
+		setCookie(w, CookieFlash, "Thanks! Your comment will be visible once the owner approves it")
+	}
+
+	showPath := fmt.Sprintf("/galleries/%d#comments", gallery.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (g Galleries) ApproveComment(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	commentID, err := strconv.Atoi(chi.URLParam(r, "commentID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = g.CommentService.Approve(gallery.ID, commentID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Comment approved")
+
+	showPath := fmt.Sprintf("/galleries/%d#comments", gallery.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (g Galleries) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	commentID, err := strconv.Atoi(chi.URLParam(r, "commentID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := g.CommentService.ByID(gallery.ID, commentID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	user := context.User(r.Context())
+	if comment.UserID != user.ID && !g.hasRole(r, gallery, models.RoleOwner) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	err = g.CommentService.Delete(gallery.ID, comment.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Comment deleted")
+
+	showPath := fmt.Sprintf("/galleries/%d#comments", gallery.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (g Galleries) UpdateCommentMode(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	mode, err := models.ParseCommentMode(r.FormValue("comments"))
+	if err != nil {
+		http.Error(w, "Invalid comment setting", http.StatusBadRequest)
+		return
+	}
+
+	err = g.CommentService.SetMode(gallery.ID, mode)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Comment settings updated")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
@@ -6,9 +6,12 @@ import (
 )
 
 const (
-	CookieSession = "session"
-	CookieTheme   = "theme"
-	CookieFlash   = "flash"
+	CookieSession   = "session"
+	CookieTheme     = "theme"
+	CookieFlash     = "flash"
+	CookieWorkspace = "workspace"
+	CookieLoginLink = "login_link"
+	CookieOIDC      = "oidc"
 )
 
 func newCookie(name, value string) *http.Cookie {
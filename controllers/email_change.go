@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+)
+
+func (u Users) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	err := u.checkCurrentPassword(w, user, r.FormValue("password"))
+	if err != nil {
+		u.renderMe(w, r, *user, err)
+		return
+	}
+
+	change, err := u.EmailChangeService.Create(user, r.FormValue("email"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEmailTaken):
+			err = errors.Public(err, "This email address is already taken. Please try another.")
+		case errors.Is(err, models.ErrInvalidEmail):
+			err = errors.Public(err, "Please enter a valid email address that differs from your current one.")
+		default:
+			fmt.Println(err)
+		}
+
+		u.renderMe(w, r, *user, err)
+		return
+	}
+
+	confirmURL := "https://www.galaria.com/users/email/confirm?" + url.Values{"token": {change.Token}}.Encode()
+	revertURL := "https://www.galaria.com/users/email/revert?" + url.Values{"token": {change.RevertToken}}.Encode()
+
+	err = u.EmailService.ConfirmEmailChange(change.NewEmail, confirmURL)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	err = u.EmailService.EmailChangeRequested(change.OldEmail, change.NewEmail, revertURL)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	setCookie(w, CookieFlash, "We sent a confirmation link to "+change.NewEmail+". Your email address changes once you click it.")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+type emailChangeData struct {
+	Title  string
+	Text   string
+	Action string
+	Button string
+	Token  string
+}
+
+// ConfirmEmailChange and RevertEmailChange only render a form, the token is
+// used by the POST so that mail scanners opening the link change nothing.
+func (u Users) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	u.Templates.EmailChange.Execute(w, r, emailChangeData{
+		Title:  "Confirm your new email address",
+		Text:   "Confirm to start signing in with this email address.",
+		Action: "/users/email/confirm",
+		Button: "Confirm email address",
+		Token:  r.FormValue("token"),
+	})
+}
+
+func (u Users) ProcessConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	change, err := u.EmailChangeService.Confirm(r.FormValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "This confirmation link is invalid or has expired", http.StatusNotFound)
+		case errors.Is(err, models.ErrEmailTaken):
+			http.Error(w, "This email address is already in use by another account", http.StatusConflict)
+		default:
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setCookie(w, CookieFlash, "Your email address was changed to "+change.NewEmail)
+
+	if context.User(r.Context()) == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	u.Templates.EmailChange.Execute(w, r, emailChangeData{
+		Title:  "Keep your previous email address",
+		Text:   "This cancels the email change, or restores your previous address and signs you out everywhere if it was already confirmed.",
+		Action: "/users/email/revert",
+		Button: "Keep my previous email address",
+		Token:  r.FormValue("token"),
+	})
+}
+
+func (u Users) ProcessRevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	change, err := u.EmailChangeService.Revert(r.FormValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "This link is invalid or has expired", http.StatusNotFound)
+		case errors.Is(err, models.ErrEmailTaken):
+			http.Error(w, "Your previous email address is now used by another account, please contact support", http.StatusConflict)
+		default:
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !change.ConfirmedAt.Valid {
+		setCookie(w, CookieFlash, "The email change was cancelled")
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	deleteCookie(w, CookieSession)
+	setCookie(w, CookieFlash, "Your email address was restored to "+change.OldEmail+" and you were signed out everywhere. We recommend resetting your password.")
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
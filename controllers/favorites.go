@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) Favorites(w http.ResponseWriter, r *http.Request) {
+	type Gallery struct {
+		ID        int
+		Title     string
+		Likes     int
+		CreatedAt string
+	}
+	type Image struct {
+		GalleryID       int
+		Filename        string
+		FilenameEscaped string
+		Caption         string
+		Likes           int
+	}
+	var data struct {
+		Galleries []Gallery
+		Images    []Image
+	}
+
+	user := context.User(r.Context())
+
+	galleries, err := g.FavoriteService.Galleries(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, gallery := range galleries {
+		data.Galleries = append(data.Galleries, Gallery{
+			ID:        gallery.ID,
+			Title:     gallery.Title,
+			Likes:     gallery.Likes,
+			CreatedAt: gallery.CreatedAt.Format("January 02, 2006 15:04"),
+		})
+	}
+
+	images, err := g.FavoriteService.Images(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, image := range images {
+		data.Images = append(data.Images, Image{
+			GalleryID:       image.GalleryID,
+			Filename:        image.Filename,
+			FilenameEscaped: url.PathEscape(image.Filename),
+			Caption:         image.Caption,
+			Likes:           image.Likes,
+		})
+	}
+
+	g.Templates.Favorites.Execute(w, r, data)
+}
+
+func (g Galleries) FavoriteGallery(w http.ResponseWriter, r *http.Request) {
+	g.toggleGalleryFavorite(w, r, g.FavoriteService.FavoriteGallery)
+}
+
+func (g Galleries) UnfavoriteGallery(w http.ResponseWriter, r *http.Request) {
+	g.toggleGalleryFavorite(w, r, g.FavoriteService.UnfavoriteGallery)
+}
+
+func (g Galleries) FavoriteImage(w http.ResponseWriter, r *http.Request) {
+	g.toggleImageFavorite(w, r, g.FavoriteService.FavoriteImage)
+}
+
+func (g Galleries) UnfavoriteImage(w http.ResponseWriter, r *http.Request) {
+	g.toggleImageFavorite(w, r, g.FavoriteService.UnfavoriteImage)
+}
+
+func (g Galleries) toggleGalleryFavorite(w http.ResponseWriter, r *http.Request, fn func(userID, galleryID int) error) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = fn(user.ID, gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+}
+
+func (g Galleries) toggleImageFavorite(w http.ResponseWriter, r *http.Request, fn func(userID, galleryID int, filename string) error) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = fn(user.ID, gallery.ID, filename)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+}
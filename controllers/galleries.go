@@ -2,10 +2,14 @@ package controllers
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexandru-calin/galaria/context"
 	"github.com/alexandru-calin/galaria/errors"
@@ -15,13 +19,25 @@ import (
 
 type Galleries struct {
 	Templates struct {
-		New   Template
-		Edit  Template
-		Index Template
-		Show  Template
-		All   Template
+		New       Template
+		Edit      Template
+		Index     Template
+		Show      Template
+		All       Template
+		Trash     Template
+		Upload    Template
+		Slideshow Template
+		Favorites Template
 	}
-	GalleryService *models.GalleryService
+	GalleryService      *models.GalleryService
+	UploadLinkService   *models.UploadLinkService
+	ProofingService     *models.ProofingService
+	CommentService      *models.CommentService
+	FavoriteService     *models.FavoriteService
+	MemberService       *models.MemberService
+	OrganizationService *models.OrganizationService
+	EmailService        *models.EmailService
+	RateLimiter         models.RateLimiter
 }
 
 func (g Galleries) New(w http.ResponseWriter, r *http.Request) {
@@ -35,13 +51,15 @@ func (g Galleries) New(w http.ResponseWriter, r *http.Request) {
 
 func (g Galleries) Create(w http.ResponseWriter, r *http.Request) {
 	var data struct {
-		UserID int
-		Title  string
+		UserID         int
+		OrganizationID int
+		Title          string
 	}
 	data.UserID = context.User(r.Context()).ID
+	data.OrganizationID = context.Workspace(r.Context()).OrganizationID()
 	data.Title = r.FormValue("title")
 
-	gallery, err := g.GalleryService.Create(data.UserID, data.Title)
+	gallery, err := g.GalleryService.Create(data.UserID, data.OrganizationID, data.Title)
 	if err != nil {
 		g.Templates.New.Execute(w, r, data, err)
 		return
@@ -54,7 +72,7 @@ func (g Galleries) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (g Galleries) Edit(w http.ResponseWriter, r *http.Request) {
-	gallery, err := g.galleryByID(w, r, userMustOwnGallery)
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleContributor))
 	if err != nil {
 		return
 	}
@@ -63,20 +81,276 @@ func (g Galleries) Edit(w http.ResponseWriter, r *http.Request) {
 		GalleryID       int
 		Filename        string
 		FilenameEscaped string
+		Caption         string
+		Tags            []string
+		Rating          int
+		Flag            models.Flag
+		Label           models.Label
 	}
 
-	var data struct {
+	type Gallery struct {
+		ID    int
+		Title string
+	}
+
+	type Member struct {
+		UserID int
+		Email  string
+		Role   models.Role
+	}
+
+	type Invitation struct {
 		ID        int
-		Title     string
-		Images    []Image
-		UpdatedAt string
-		Flash     string
+		Email     string
+		Role      models.Role
+		ExpiresAt string
+	}
+
+	type Organization struct {
+		ID   int
+		Name string
+	}
+
+	type PendingImage struct {
+		GalleryID       int
+		Filename        string
+		FilenameEscaped string
+		UploadedBy      string
+		Size            string
+	}
+
+	type ProofImage struct {
+		Filename string
+		Note     string
+	}
+
+	type ProofSelection struct {
+		ID          int
+		Email       string
+		Images      []ProofImage
+		SubmittedAt string
+	}
+
+	type UploadLink struct {
+		ID        int
+		Label     string
+		Uploads   int
+		MaxFiles  int
+		MaxSize   string
+		ExpiresAt string
+	}
+
+	var data struct {
+		ID          int
+		Title       string
+		Images      []Image
+		Galleries   []Gallery
+		UpdatedAt   string
+		Flash       string
+		UserID      int
+		IsMember    bool
+		CanEdit     bool
+		CanManage   bool
+		Roles       []models.Role
+		Members     []Member
+		Invitations []Invitation
+
+		OrganizationID int
+		Organizations  []Organization
+
+		PendingImages []PendingImage
+		UploadLinks   []UploadLink
+
+		Proofing        bool
+		ProofingLimit   int
+		ProofSelections []ProofSelection
+
+		CommentMode models.CommentMode
+
+		Filter      models.ImageFilter
+		Flags       []models.Flag
+		Labels      []models.Label
+		SortColumns []string
 	}
 	data.ID = gallery.ID
 	data.Title = gallery.Title
 	data.UpdatedAt = gallery.UpdatedAt.Format("January 02, 2006 15:04")
+	data.Proofing = gallery.Proofing
+	data.ProofingLimit = gallery.ProofingLimit
+	data.CommentMode = gallery.Comments
+
+	user := context.User(r.Context())
+
+	role, err := g.MemberService.Role(gallery, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+	data.UserID = user.ID
+	data.CanEdit = role.Includes(models.RoleEditor)
+	data.CanManage = role.Includes(models.RoleOwner)
+
+	data.IsMember, err = g.MemberService.IsMember(gallery.ID, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	galleries, err := g.GalleryService.ByUserID(user.ID, "title", "asc")
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, other := range galleries {
+		if other.ID == gallery.ID {
+			continue
+		}
 
-	images, err := g.GalleryService.Images(gallery.ID)
+		data.Galleries = append(data.Galleries, Gallery{
+			ID:    other.ID,
+			Title: other.Title,
+		})
+	}
+
+	shared, err := g.MemberService.SharedWith(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, other := range shared {
+		if other.ID == gallery.ID || !other.Role.Includes(models.RoleContributor) {
+			continue
+		}
+
+		data.Galleries = append(data.Galleries, Gallery{
+			ID:    other.ID,
+			Title: other.Title,
+		})
+	}
+
+	if data.CanManage {
+		data.Roles = models.Roles()
+		data.OrganizationID = gallery.OrganizationID
+
+		for _, organization := range context.Workspace(r.Context()).Organizations {
+			data.Organizations = append(data.Organizations, Organization{
+				ID:   organization.ID,
+				Name: organization.Name,
+			})
+		}
+
+		members, err := g.MemberService.Members(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, member := range members {
+			data.Members = append(data.Members, Member{
+				UserID: member.UserID,
+				Email:  member.Email,
+				Role:   member.Role,
+			})
+		}
+
+		invitations, err := g.MemberService.Invitations(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, invitation := range invitations {
+			data.Invitations = append(data.Invitations, Invitation{
+				ID:        invitation.ID,
+				Email:     invitation.Email,
+				Role:      invitation.Role,
+				ExpiresAt: invitation.ExpiresAt.Format("January 02, 2006 15:04"),
+			})
+		}
+
+		links, err := g.UploadLinkService.ByGalleryID(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, link := range links {
+			data.UploadLinks = append(data.UploadLinks, UploadLink{
+				ID:        link.ID,
+				Label:     link.Label,
+				Uploads:   link.Uploads,
+				MaxFiles:  link.MaxFiles,
+				MaxSize:   formatBytes(link.MaxBytes),
+				ExpiresAt: link.ExpiresAt.Format("January 02, 2006 15:04"),
+			})
+		}
+	}
+
+	if data.CanEdit {
+		pending, err := g.GalleryService.PendingImages(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, image := range pending {
+			data.PendingImages = append(data.PendingImages, PendingImage{
+				GalleryID:       gallery.ID,
+				Filename:        image.Filename,
+				FilenameEscaped: url.PathEscape(image.Filename),
+				UploadedBy:      image.UploadedBy,
+				Size:            formatBytes(image.Size),
+			})
+		}
+
+		selections, err := g.ProofingService.Selections(gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, selection := range selections {
+			proofSelection := ProofSelection{
+				ID:    selection.ID,
+				Email: selection.Email,
+			}
+
+			if selection.Submitted() {
+				proofSelection.SubmittedAt = selection.SubmittedAt.Format("January 02, 2006 15:04")
+			}
+
+			for _, image := range selection.Images {
+				proofSelection.Images = append(proofSelection.Images, ProofImage{
+					Filename: image.Filename,
+					Note:     image.Note,
+				})
+			}
+
+			data.ProofSelections = append(data.ProofSelections, proofSelection)
+		}
+	}
+
+	data.Filter.MinRating, _ = strconv.Atoi(r.FormValue("rating"))
+	data.Filter.Flag = r.FormValue("flag")
+	data.Filter.Label = r.FormValue("label")
+	data.Filter.Sort = r.FormValue("s")
+	data.Filter.Order = r.FormValue("o")
+	data.Flags = models.Flags()
+	data.Labels = models.Labels()
+	data.SortColumns = models.ImageSortColumns()
+
+	images, err := g.GalleryService.Images(gallery.ID, data.Filter)
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
@@ -88,6 +362,11 @@ func (g Galleries) Edit(w http.ResponseWriter, r *http.Request) {
 			GalleryID:       gallery.ID,
 			Filename:        image.Filename,
 			FilenameEscaped: url.PathEscape(image.Filename),
+			Caption:         image.Caption,
+			Tags:            image.Tags,
+			Rating:          image.Rating,
+			Flag:            image.Flag,
+			Label:           image.Label,
 		})
 	}
 
@@ -109,7 +388,7 @@ func (g Galleries) Edit(w http.ResponseWriter, r *http.Request) {
 }
 
 func (g Galleries) Update(w http.ResponseWriter, r *http.Request) {
-	gallery, err := g.galleryByID(w, r, userMustOwnGallery)
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleEditor))
 	if err != nil {
 		return
 	}
@@ -134,22 +413,110 @@ func (g Galleries) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	type Comment struct {
+		ID        int
+		Filename  string
+		UserID    int
+		Handle    string
+		Author    string
+		Body      string
+		Approved  bool
+		CreatedAt string
+	}
+
 	type Image struct {
 		GalleryID       int
 		Filename        string
 		FilenameEscaped string
+		Caption         string
+		Tags            []string
 		CreatedAt       string
+		Selected        bool
+		Note            string
+		Likes           int
+		Favorite        bool
 	}
 
 	var data struct {
+		ID        int
 		Title     string
 		Images    []Image
 		UpdatedAt string
+		Flash     string
+		Sort      string
+
+		OwnerHandle string
+		OwnerName   string
+
+		Likes    int
+		Favorite bool
+		LoggedIn bool
+
+		Proofing      bool
+		ProofingLimit int
+		Selected      int
+		Submitted     bool
+
+		Comments        []Comment
+		CanComment      bool
+		CanModerate     bool
+		UserID          int
+		CommentsEnabled bool
 	}
+	data.ID = gallery.ID
 	data.Title = gallery.Title
 	data.UpdatedAt = gallery.UpdatedAt.Format("January 02, 2006 15:04")
+	data.Likes = gallery.Likes
+	data.OwnerHandle = gallery.OwnerHandle
+	data.OwnerName = gallery.OwnerName
 
-	images, err := g.GalleryService.Images(gallery.ID)
+	user := context.User(r.Context())
+	favorites := make(map[string]bool)
+
+	if user != nil {
+		data.UserID = user.ID
+		data.LoggedIn = true
+
+		data.Favorite, err = g.FavoriteService.IsGalleryFavorite(user.ID, gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		favorites, err = g.FavoriteService.FavoriteFilenames(user.ID, gallery.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	notes := make(map[string]string)
+
+	if gallery.Proofing && g.hasRole(r, gallery, models.RoleViewer) {
+		selection, err := g.ProofingService.Selection(gallery.ID, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, image := range selection.Images {
+			notes[image.Filename] = image.Note
+		}
+
+		data.Proofing = true
+		data.ProofingLimit = gallery.ProofingLimit
+		data.Selected = len(selection.Images)
+		data.Submitted = selection.Submitted()
+	}
+
+	if r.FormValue("sort") == "likes" {
+		data.Sort = "likes"
+	}
+
+	images, err := g.GalleryService.Images(gallery.ID, models.ImageFilter{Sort: data.Sort})
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
@@ -157,14 +524,58 @@ func (g Galleries) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, image := range images {
+		note, selected := notes[image.Filename]
+
 		data.Images = append(data.Images, Image{
 			GalleryID:       image.GalleryID,
 			Filename:        image.Filename,
 			FilenameEscaped: url.PathEscape(image.Filename),
+			Caption:         image.Caption,
+			Tags:            image.Tags,
 			CreatedAt:       image.CreatedAt.Format("January 02, 2006 15:04"),
+			Selected:        selected,
+			Note:            note,
+			Likes:           image.Likes,
+			Favorite:        favorites[image.Filename],
+		})
+	}
+
+	data.CommentsEnabled = gallery.Comments != models.CommentsDisabled
+	data.CanComment = user != nil && data.CommentsEnabled
+	data.CanModerate = g.hasRole(r, gallery, models.RoleOwner)
+
+	comments, err := g.CommentService.ByGalleryID(gallery.ID, data.CanModerate)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, comment := range comments {
+		data.Comments = append(data.Comments, Comment{
+			ID:        comment.ID,
+			Filename:  comment.Filename,
+			UserID:    comment.UserID,
+			Handle:    comment.Handle,
+			Author:    comment.Author,
+			Body:      comment.Body,
+			Approved:  comment.Approved,
+			CreatedAt: comment.CreatedAt.Format("January 02, 2006 15:04"),
 		})
 	}
 
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
 	g.Templates.Show.Execute(w, r, data)
 }
 
@@ -189,15 +600,72 @@ func (g Galleries) Image(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.ServeFile(w, r, image.Path)
+	if image.Pending && !g.canModerate(r, galleryID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := image.Path
+
+	w.Header().Add("Vary", "Accept")
+	rendition := bestRendition(r.Header.Get("Accept"), image.Renditions)
+	if rendition != nil {
+		w.Header().Set("Content-Type", rendition.ContentType)
+		path = rendition.Path
+	}
+
+	serveImage(w, r, image.Filename, path, image.CreatedAt)
+}
+
+func (g Galleries) Original(w http.ResponseWriter, r *http.Request) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	image, err := g.GalleryService.Image(gallery.ID, filename)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	if image.Pending && !g.canModerate(r, gallery.ID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := image.OriginalPath
+	if path == "" {
+		path = image.Path
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": image.Filename})
+	w.Header().Set("Content-Disposition", disposition)
+
+	serveImage(w, r, image.Filename, path, image.CreatedAt)
 }
 
 func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
-	gallery, err := g.galleryByID(w, r, userMustOwnGallery)
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleContributor))
 	if err != nil {
 		return
 	}
 
+	user := context.User(r.Context())
+	err = takeRateLimit(w, g.RateLimiter, fmt.Sprintf("upload:user:%d", user.ID), UploadLimit)
+	if err != nil {
+		writeRateLimitError(w, err)
+		return
+	}
+
 	err = r.ParseMultipartForm(5 << 20)
 	if err != nil {
 		fmt.Println(err)
@@ -219,11 +687,17 @@ func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			var fileErr models.FileError
 			if errors.As(err, &fileErr) {
-				msg := fmt.Sprintf("%v has an invalid content type or extension", fileHeader.Filename)
+				msg := fmt.Sprintf("%v is not a valid image: %v", fileHeader.Filename, fileErr.Issue)
 				http.Error(w, msg, http.StatusBadRequest)
 				return
 			}
 
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				msg := fmt.Sprintf("Uploading %v would exceed your storage quota", fileHeader.Filename)
+				http.Error(w, msg, http.StatusForbidden)
+				return
+			}
+
 			fmt.Println(err)
 			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
 			return
@@ -246,7 +720,7 @@ func (g Galleries) UploadImage(w http.ResponseWriter, r *http.Request) {
 func (g Galleries) DeleteImage(w http.ResponseWriter, r *http.Request) {
 	filename := filepath.Base(chi.URLParam(r, "filename"))
 
-	gallery, err := g.galleryByID(w, r, userMustOwnGallery)
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleEditor))
 	if err != nil {
 		return
 	}
@@ -265,14 +739,107 @@ func (g Galleries) DeleteImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setCookie(w, CookieFlash, "Gallery updated successfully")
+	setCookie(w, CookieFlash, "Image moved to trash")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) Duplicate(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleEditor))
+	if err != nil {
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = gallery.Title + " (copy)"
+	}
+
+	user := context.User(r.Context())
+
+	duplicate, err := g.GalleryService.Duplicate(gallery.ID, user.ID, title)
+	if err != nil {
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			http.Error(w, "Duplicating this gallery would exceed your storage quota", http.StatusForbidden)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Gallery duplicated successfully")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", duplicate.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) Transfer(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	owns := gallery.OrganizationID == 0 && gallery.UserID == user.ID
+	if gallery.OrganizationID != 0 {
+		role, err := g.OrganizationService.Role(gallery.OrganizationID, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		owns = role == models.OrgRoleAdmin
+	}
+
+	if !owns {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	organizationID, err := strconv.Atoi(r.FormValue("organization_id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	flash := "Gallery moved to your personal account"
+
+	if organizationID != 0 {
+		role, err := g.OrganizationService.Role(organizationID, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		if role == "" {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		flash = "Gallery transferred to the organization"
+	}
+
+	err = g.GalleryService.Transfer(gallery.ID, user.ID, organizationID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, flash)
 
 	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
 	http.Redirect(w, r, editPath, http.StatusFound)
 }
 
 func (g Galleries) Delete(w http.ResponseWriter, r *http.Request) {
-	gallery, err := g.galleryByID(w, r, userMustOwnGallery)
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
 	if err != nil {
 		return
 	}
@@ -283,7 +850,7 @@ func (g Galleries) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setCookie(w, CookieFlash, "Gallery deleted successfully")
+	setCookie(w, CookieFlash, "Gallery moved to trash")
 
 	http.Redirect(w, r, "/galleries", http.StatusFound)
 }
@@ -293,12 +860,22 @@ func (g Galleries) Index(w http.ResponseWriter, r *http.Request) {
 		ID        int
 		Title     string
 		CreatedAt string
+		Images    int
+		Size      string
+	}
+	type SharedGallery struct {
+		ID        int
+		Title     string
+		CreatedAt string
+		Role      models.Role
 	}
 	var data struct {
-		Galleries []Gallery
-		Flash     string
-		Sort      string
-		Order     string
+		Organization string
+		Galleries    []Gallery
+		Shared       []SharedGallery
+		Flash        string
+		Sort         string
+		Order        string
 	}
 
 	sort := r.FormValue("s")
@@ -312,18 +889,56 @@ func (g Galleries) Index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := context.User(r.Context())
+	workspace := context.Workspace(r.Context())
+
+	var galleries []models.Gallery
+	var usages map[int]models.GalleryUsage
+	var err error
+
+	if workspace.Current != nil {
+		data.Organization = workspace.Current.Name
 
-	galleries, err := g.GalleryService.ByUserID(user.ID, sort, order)
+		galleries, err = g.GalleryService.ByOrganizationID(workspace.Current.ID, sort, order)
+		if err == nil {
+			usages, err = g.GalleryService.UsageByOrganization(workspace.Current.ID)
+		}
+	} else {
+		galleries, err = g.GalleryService.ByUserID(user.ID, sort, order)
+		if err == nil {
+			usages, err = g.GalleryService.UsageByGallery(user.ID)
+		}
+	}
 	if err != nil {
+		fmt.Println(err)
 		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
 		return
 	}
 
 	for _, gallery := range galleries {
+		usage := usages[gallery.ID]
+
 		data.Galleries = append(data.Galleries, Gallery{
 			ID:        gallery.ID,
 			Title:     gallery.Title,
 			CreatedAt: gallery.CreatedAt.Format("01-02-2006 15:04"),
+			Images:    usage.Images,
+			Size:      formatBytes(usage.Bytes),
+		})
+	}
+
+	shared, err := g.MemberService.SharedWith(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, gallery := range shared {
+		data.Shared = append(data.Shared, SharedGallery{
+			ID:        gallery.ID,
+			Title:     gallery.Title,
+			CreatedAt: gallery.CreatedAt.Format("01-02-2006 15:04"),
+			Role:      gallery.Role,
 		})
 	}
 
@@ -345,6 +960,63 @@ func (g Galleries) Index(w http.ResponseWriter, r *http.Request) {
 	g.Templates.Index.Execute(w, r, data)
 }
 
+func serveImage(w http.ResponseWriter, r *http.Request, name, path string, modtime time.Time) {
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+
+	http.ServeContent(w, r, name, modtime, f)
+}
+
+func bestRendition(accept string, renditions []models.Rendition) *models.Rendition {
+	var best *models.Rendition
+	var bestQuality float64
+
+	for i, rendition := range renditions {
+		quality := explicitQuality(accept, rendition.ContentType)
+		if quality <= 0 {
+			continue
+		}
+
+		if best == nil || quality > bestQuality || (quality == bestQuality && rendition.Size < best.Size) {
+			best = &renditions[i]
+			bestQuality = quality
+		}
+	}
+
+	return best
+}
+
+func explicitQuality(accept, contentType string) float64 {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != contentType {
+			continue
+		}
+
+		q, ok := params["q"]
+		if !ok {
+			return 1
+		}
+
+		quality, err := strconv.ParseFloat(q, 64)
+		if err != nil {
+			return 0
+		}
+
+		return quality
+	}
+
+	return 0
+}
+
 type galleryOpt func(w http.ResponseWriter, r *http.Request, gallery *models.Gallery) error
 
 func (g Galleries) galleryByID(w http.ResponseWriter, r *http.Request, opts ...galleryOpt) (*models.Gallery, error) {
@@ -375,12 +1047,45 @@ func (g Galleries) galleryByID(w http.ResponseWriter, r *http.Request, opts ...g
 	return gallery, nil
 }
 
-func userMustOwnGallery(w http.ResponseWriter, r *http.Request, gallery *models.Gallery) error {
+func (g Galleries) requireRole(role models.Role) galleryOpt {
+	return func(w http.ResponseWriter, r *http.Request, gallery *models.Gallery) error {
+		user := context.User(r.Context())
+
+		userRole, err := g.MemberService.Role(gallery, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return err
+		}
+
+		if !userRole.Includes(role) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return fmt.Errorf("user does not have the %s role on the gallery", role)
+		}
+
+		return nil
+	}
+}
+
+func (g Galleries) canModerate(r *http.Request, galleryID int) bool {
+	gallery, err := g.GalleryService.ByID(galleryID)
+	if err != nil {
+		return false
+	}
+
+	return g.hasRole(r, gallery, models.RoleEditor)
+}
+
+func (g Galleries) hasRole(r *http.Request, gallery *models.Gallery, role models.Role) bool {
 	user := context.User(r.Context())
-	if user.ID != gallery.UserID {
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		return fmt.Errorf("user does not own the gallery")
+	if user == nil {
+		return false
+	}
+
+	userRole, err := g.MemberService.Role(gallery, user.ID)
+	if err != nil {
+		return false
 	}
 
-	return nil
+	return userRole.Includes(role)
 }
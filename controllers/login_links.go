@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+)
+
+func (u Users) ProcessLoginLink(w http.ResponseWriter, r *http.Request) {
+	email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+
+	err := takeRateLimit(w, u.RateLimiter, "login-link:"+clientIP(r), LoginLinkLimit)
+	if err == nil {
+		err = takeRateLimit(w, u.RateLimiter, "login-link-email:"+email, LoginLinkEmailLimit)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrRateLimited) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		u.renderLogin(w, r, "", err)
+		return
+	}
+
+	var data struct {
+		LoginLink bool
+	}
+	data.LoginLink = true
+
+	browserToken, err := u.LoginLinkService.BrowserToken()
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	// Set the cookie whether or not the email belongs to an account, so the
+	// response doesn't reveal which addresses are registered.
+	setCookie(w, CookieLoginLink, browserToken)
+
+	link, err := u.LoginLinkService.Create(email, browserToken)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			u.Templates.CheckYourEmail.Execute(w, r, data)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	loginURL := "https://www.galaria.com/login/link?" + url.Values{"token": {link.Token}}.Encode()
+
+	err = u.EmailService.LoginLink(link.Email, loginURL)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	u.Templates.CheckYourEmail.Execute(w, r, data)
+}
+
+func (u Users) LoginWithLink(w http.ResponseWriter, r *http.Request) {
+	browserToken, err := readCookie(r, CookieLoginLink)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		msg := "This sign-in link must be opened in the browser you requested it from."
+		u.renderLogin(w, r, "", errors.Public(err, msg))
+		return
+	}
+
+	user, err := u.LoginLinkService.Consume(r.FormValue("token"), browserToken)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			w.WriteHeader(http.StatusBadRequest)
+			msg := "This sign-in link is invalid, has expired, or was requested from another browser."
+			err = errors.Public(err, msg)
+		} else {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		u.renderLogin(w, r, "", err)
+		return
+	}
+
+	deleteCookie(w, CookieLoginLink)
+	u.resetLoginFailures(user.Email)
+
+	session, err := u.SessionService.Create(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieSession, session.Token)
+	setCookie(w, CookieFlash, fmt.Sprintf("Successfully logged in as %s", user.Email))
+	http.Redirect(w, r, "/galleries", http.StatusFound)
+}
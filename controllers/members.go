@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) InviteMember(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+	if email == "" || email == user.Email {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	role, err := models.ParseRole(r.FormValue("role"))
+	if err != nil {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := g.MemberService.Invite(gallery.ID, user.ID, email, role)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	vals := url.Values{
+		"token": {invitation.Token},
+	}
+	acceptURL := "https://www.galaria.com/invitations/accept?" + vals.Encode()
+
+	err = g.EmailService.GalleryInvitation(invitation.Email, user.Email, gallery.Title, acceptURL)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation sent to "+invitation.Email)
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	role, err := models.ParseRole(r.FormValue("role"))
+	if err != nil {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	err = g.MemberService.UpdateRole(gallery.ID, userID, role)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Member role updated")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user := context.User(r.Context())
+
+	if userID == user.ID {
+		gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleViewer))
+		if err != nil {
+			return
+		}
+
+		err = g.MemberService.Remove(gallery.ID, user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		setCookie(w, CookieFlash, "You left "+gallery.Title)
+
+		http.Redirect(w, r, "/galleries", http.StatusFound)
+		return
+	}
+
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	err = g.MemberService.Remove(gallery.ID, userID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Member removed")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = g.MemberService.RevokeInvitation(gallery.ID, invitationID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation revoked")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	invitation, err := g.MemberService.Accept(r.FormValue("token"), user)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This invitation is invalid, has expired, or was sent to another email address", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, models.ErrOwnGallery) {
+			http.Error(w, "You already own this gallery", http.StatusConflict)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation accepted")
+
+	if invitation.Role.Includes(models.RoleContributor) {
+		editPath := fmt.Sprintf("/galleries/%d/edit", invitation.GalleryID)
+		http.Redirect(w, r, editPath, http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/galleries", http.StatusFound)
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type oidcAccount struct {
+	Provider *models.OIDCProvider
+	Identity *models.Identity
+}
+
+func oidcAccounts(providers []*models.OIDCProvider, identities []models.Identity) []oidcAccount {
+	accounts := make([]oidcAccount, len(providers))
+
+	for i, provider := range providers {
+		accounts[i].Provider = provider
+		for j := range identities {
+			if identities[j].Provider == provider.Name {
+				accounts[i].Identity = &identities[j]
+			}
+		}
+	}
+
+	return accounts
+}
+
+func (u Users) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	u.startOIDC(w, r, false)
+}
+
+func (u Users) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	u.startOIDC(w, r, true)
+}
+
+func (u Users) startOIDC(w http.ResponseWriter, r *http.Request, link bool) {
+	provider, ok := u.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authReq, err := models.NewOIDCAuthRequest(provider.Name, link)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(authReq)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, provider.DisplayName+" is unavailable right now, please try again later", http.StatusBadGateway)
+		return
+	}
+
+	vals := url.Values{
+		"provider": {authReq.Provider},
+		"state":    {authReq.State},
+		"nonce":    {authReq.Nonce},
+		"verifier": {authReq.Verifier},
+		"link":     {strconv.FormatBool(authReq.Link)},
+	}
+
+	cookie := newCookie(CookieOIDC, vals.Encode())
+	cookie.MaxAge = 600
+	cookie.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, cookie)
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (u Users) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := u.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	value, err := readCookie(r, CookieOIDC)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		u.renderLogin(w, r, "", errors.Public(err, "Your sign in session expired. Please try again."))
+		return
+	}
+	deleteCookie(w, CookieOIDC)
+
+	vals, err := url.ParseQuery(value)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Invalid sign in request", http.StatusBadRequest)
+		return
+	}
+
+	authReq := models.OIDCAuthRequest{
+		Provider: vals.Get("provider"),
+		State:    vals.Get("state"),
+		Nonce:    vals.Get("nonce"),
+		Verifier: vals.Get("verifier"),
+		Link:     vals.Get("link") == "true",
+	}
+
+	state := r.FormValue("state")
+	if authReq.Provider != provider.Name || authReq.State == "" || subtle.ConstantTimeCompare([]byte(state), []byte(authReq.State)) != 1 {
+		http.Error(w, "Invalid sign in request", http.StatusBadRequest)
+		return
+	}
+
+	if errCode := r.FormValue("error"); errCode != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		err = fmt.Errorf("oidc %s: %s %s", provider.Name, errCode, r.FormValue("error_description"))
+		u.renderLogin(w, r, "", errors.Public(err, "Sign in with "+provider.DisplayName+" was cancelled or denied."))
+		return
+	}
+
+	claims, err := provider.Exchange(&authReq, r.FormValue("code"))
+	if err != nil {
+		fmt.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		u.renderLogin(w, r, "", errors.Public(err, "We couldn't verify your sign in with "+provider.DisplayName+". Please try again."))
+		return
+	}
+
+	if authReq.Link {
+		u.linkIdentity(w, r, provider, claims)
+		return
+	}
+
+	user, err := u.oidcUser(provider, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusForbidden)
+			msg := "There is no account linked to this " + provider.DisplayName + " identity. Log in and link it from your account page."
+			err = errors.Public(err, msg)
+		case errors.Is(err, models.ErrAlreadyLinked):
+			w.WriteHeader(http.StatusConflict)
+			err = errors.Public(err, "This account is already linked to another "+provider.DisplayName+" identity.")
+		default:
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		u.renderLogin(w, r, "", err)
+		return
+	}
+
+	session, err := u.SessionService.Create(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieSession, session.Token)
+	setCookie(w, CookieFlash, fmt.Sprintf("Successfully logged in as %s", user.Email))
+	http.Redirect(w, r, "/galleries", http.StatusFound)
+}
+
+func (u Users) oidcUser(provider *models.OIDCProvider, claims *models.OIDCClaims) (*models.User, error) {
+	user, err := u.IdentityService.User(provider.Name, claims.Subject)
+	if err == nil || !errors.Is(err, models.ErrNotFound) {
+		return user, err
+	}
+
+	email, ok := claims.VerifiedEmail()
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	user, err = u.UserService.ByEmail(email)
+	if errors.Is(err, models.ErrNotFound) && provider.Signup {
+		user, err = u.UserService.CreateExternal(email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.IdentityService.Link(user.ID, provider.Name, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u Users) linkIdentity(w http.ResponseWriter, r *http.Request, provider *models.OIDCProvider, claims *models.OIDCClaims) {
+	user := context.User(r.Context())
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err := u.IdentityService.Link(user.ID, provider.Name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrIdentityTaken):
+			err = errors.Public(err, "This "+provider.DisplayName+" identity is already linked to another account.")
+		case errors.Is(err, models.ErrAlreadyLinked):
+			err = errors.Public(err, "Your account is already linked to a "+provider.DisplayName+" identity. Unlink it first.")
+		default:
+			fmt.Println(err)
+		}
+
+		u.renderMe(w, r, *user, err)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Your "+provider.DisplayName+" account is now linked")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	provider, ok := u.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	err := u.IdentityService.Unlink(user.ID, provider.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrLastLoginMethod):
+			msg := "Set a password or link another account before unlinking " + provider.DisplayName + "."
+			u.renderMe(w, r, *user, errors.Public(err, msg))
+		default:
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setCookie(w, CookieFlash, "Your "+provider.DisplayName+" account was unlinked")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) oidcProvider(w http.ResponseWriter, r *http.Request) (*models.OIDCProvider, bool) {
+	name := chi.URLParam(r, "provider")
+
+	for _, provider := range u.OIDCProviders {
+		if provider.Name == name {
+			return provider, true
+		}
+	}
+
+	http.NotFound(w, r)
+
+	return nil, false
+}
@@ -0,0 +1,483 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type Organizations struct {
+	Templates struct {
+		Index Template
+		Show  Template
+	}
+	OrganizationService *models.OrganizationService
+	EmailService        *models.EmailService
+}
+
+func (o Organizations) Index(w http.ResponseWriter, r *http.Request) {
+	type Organization struct {
+		ID   int
+		Name string
+		Role models.OrganizationRole
+	}
+	var data struct {
+		Organizations []Organization
+		Flash         string
+	}
+
+	for _, organization := range context.Workspace(r.Context()).Organizations {
+		data.Organizations = append(data.Organizations, Organization{
+			ID:   organization.ID,
+			Name: organization.Name,
+			Role: organization.Role,
+		})
+	}
+
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
+	o.Templates.Index.Execute(w, r, data)
+}
+
+func (o Organizations) Create(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	user := context.User(r.Context())
+
+	organization, err := o.OrganizationService.Create(user.ID, name)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Organization created successfully")
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) Show(w http.ResponseWriter, r *http.Request) {
+	organization, role, err := o.organizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	type Member struct {
+		UserID int
+		Email  string
+		Role   models.OrganizationRole
+	}
+	type Invitation struct {
+		ID        int
+		Email     string
+		Role      models.OrganizationRole
+		ExpiresAt string
+	}
+	var data struct {
+		ID          int
+		Name        string
+		UserID      int
+		IsAdmin     bool
+		Roles       []models.OrganizationRole
+		Members     []Member
+		Invitations []Invitation
+		Flash       string
+	}
+	data.ID = organization.ID
+	data.Name = organization.Name
+	data.UserID = context.User(r.Context()).ID
+	data.IsAdmin = role == models.OrgRoleAdmin
+	data.Roles = models.OrganizationRoles()
+
+	members, err := o.OrganizationService.Members(organization.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, member := range members {
+		data.Members = append(data.Members, Member{
+			UserID: member.UserID,
+			Email:  member.Email,
+			Role:   member.Role,
+		})
+	}
+
+	if data.IsAdmin {
+		invitations, err := o.OrganizationService.Invitations(organization.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		for _, invitation := range invitations {
+			data.Invitations = append(data.Invitations, Invitation{
+				ID:        invitation.ID,
+				Email:     invitation.Email,
+				Role:      invitation.Role,
+				ExpiresAt: invitation.ExpiresAt.Format("January 02, 2006 15:04"),
+			})
+		}
+	}
+
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
+	o.Templates.Show.Execute(w, r, data)
+}
+
+func (o Organizations) Update(w http.ResponseWriter, r *http.Request) {
+	organization, err := o.adminOrganizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	organization.Name = strings.TrimSpace(r.FormValue("name"))
+	if organization.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	err = o.OrganizationService.Update(organization)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Organization updated successfully")
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) Delete(w http.ResponseWriter, r *http.Request) {
+	organization, err := o.adminOrganizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	err = o.OrganizationService.Delete(organization.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Organization deleted, its galleries were returned to their creators")
+
+	http.Redirect(w, r, "/organizations", http.StatusFound)
+}
+
+func (o Organizations) Invite(w http.ResponseWriter, r *http.Request) {
+	organization, err := o.adminOrganizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+	if email == "" || email == user.Email {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	role, err := models.ParseOrganizationRole(r.FormValue("role"))
+	if err != nil {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := o.OrganizationService.Invite(organization.ID, user.ID, email, role)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	vals := url.Values{
+		"token": {invitation.Token},
+	}
+	acceptURL := "https://www.galaria.com/organizations/invitations/accept?" + vals.Encode()
+
+	err = o.EmailService.OrganizationInvitation(invitation.Email, user.Email, organization.Name, acceptURL)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation sent to "+invitation.Email)
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	organization, err := o.adminOrganizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	role, err := models.ParseOrganizationRole(r.FormValue("role"))
+	if err != nil {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	err = o.OrganizationService.UpdateRole(organization.ID, userID, role)
+	if err != nil {
+		o.memberError(w, r, err)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Member role updated")
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user := context.User(r.Context())
+
+	var organization *models.Organization
+	if userID == user.ID {
+		organization, _, err = o.organizationByID(w, r)
+	} else {
+		organization, err = o.adminOrganizationByID(w, r)
+	}
+	if err != nil {
+		return
+	}
+
+	err = o.OrganizationService.RemoveMember(organization.ID, userID)
+	if err != nil {
+		o.memberError(w, r, err)
+		return
+	}
+
+	if userID == user.ID {
+		setCookie(w, CookieFlash, "You left "+organization.Name)
+		http.Redirect(w, r, "/organizations", http.StatusFound)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Member removed")
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	organization, err := o.adminOrganizationByID(w, r)
+	if err != nil {
+		return
+	}
+
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = o.OrganizationService.RevokeInvitation(organization.ID, invitationID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation revoked")
+
+	showPath := fmt.Sprintf("/organizations/%d", organization.ID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	invitation, err := o.OrganizationService.Accept(r.FormValue("token"), user)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This invitation is invalid, has expired, or was sent to another email address", http.StatusNotFound)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Invitation accepted")
+	setCookie(w, CookieWorkspace, strconv.Itoa(invitation.OrganizationID))
+
+	showPath := fmt.Sprintf("/organizations/%d", invitation.OrganizationID)
+	http.Redirect(w, r, showPath, http.StatusFound)
+}
+
+func (o Organizations) SwitchWorkspace(w http.ResponseWriter, r *http.Request) {
+	organizationID := r.FormValue("organization_id")
+	if organizationID == "" {
+		deleteCookie(w, CookieWorkspace)
+	} else {
+		setCookie(w, CookieWorkspace, organizationID)
+	}
+
+	http.Redirect(w, r, "/galleries", http.StatusFound)
+}
+
+func (o Organizations) memberError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		http.NotFound(w, r)
+
+	case errors.Is(err, models.ErrLastAdmin):
+		http.Error(w, "An organization must keep at least one admin", http.StatusConflict)
+
+	default:
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+	}
+}
+
+func (o Organizations) organizationByID(w http.ResponseWriter, r *http.Request) (*models.Organization, models.OrganizationRole, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, "", err
+	}
+
+	user := context.User(r.Context())
+
+	role, err := o.OrganizationService.Role(id, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return nil, "", err
+	}
+
+	if role == "" {
+		http.NotFound(w, r)
+		return nil, "", fmt.Errorf("user is not a member of the organization")
+	}
+
+	organization, err := o.OrganizationService.ByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return nil, "", err
+		}
+
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return nil, "", err
+	}
+
+	return organization, role, nil
+}
+
+func (o Organizations) adminOrganizationByID(w http.ResponseWriter, r *http.Request) (*models.Organization, error) {
+	organization, role, err := o.organizationByID(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if role != models.OrgRoleAdmin {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, fmt.Errorf("user is not an admin of the organization")
+	}
+
+	return organization, nil
+}
+
+type OrganizationMiddleware struct {
+	OrganizationService *models.OrganizationService
+}
+
+// SetWorkspace makes the user's organizations available to handlers and
+// templates. They are only queried once something reads the workspace, so
+// images, assets and event streams don't hit the database for it.
+func (omw OrganizationMiddleware) SetWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		value, _ := readCookie(r, CookieWorkspace)
+
+		ctx := r.Context()
+		ctx = context.WithWorkspace(ctx, func() *models.Workspace {
+			return omw.workspace(user.ID, value)
+		})
+		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (omw OrganizationMiddleware) workspace(userID int, current string) *models.Workspace {
+	organizations, err := omw.OrganizationService.ByUserID(userID)
+	if err != nil {
+		fmt.Println(err)
+		return &models.Workspace{}
+	}
+
+	workspace := models.Workspace{
+		Organizations: organizations,
+	}
+
+	id, _ := strconv.Atoi(current)
+	for i := range organizations {
+		if organizations[i].ID == id {
+			workspace.Current = &organizations[i]
+		}
+	}
+
+	return &workspace
+}
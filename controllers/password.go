@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+)
+
+func (u Users) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	if user.PasswordHash != "" {
+		err := u.checkCurrentPassword(w, user, r.FormValue("current_password"))
+		if err != nil {
+			u.renderMe(w, r, *user, err)
+			return
+		}
+	}
+
+	password := r.FormValue("password")
+	if password != r.FormValue("password_confirm") {
+		err := errors.Public(fmt.Errorf("password confirmation mismatch"), "The new passwords don't match.")
+		u.renderMe(w, r, *user, err)
+		return
+	}
+
+	err := u.UserService.UpdatePassword(user.ID, password)
+	if err != nil {
+		if errors.Is(err, models.ErrWeakPassword) {
+			u.renderMe(w, r, *user, publicPasswordError(err))
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	session, err := u.SessionService.Create(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	err = u.EmailService.PasswordChanged(user.Email, "https://www.galaria.com/forgot-password")
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	setCookie(w, CookieSession, session.Token)
+	setCookie(w, CookieFlash, "Password changed, you were signed out on every other device")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+// checkCurrentPassword re-authenticates a signed in user. Failures count
+// towards the same lockout as failed logins, so a stolen session can't be
+// used to guess the password.
+func (u Users) checkCurrentPassword(w http.ResponseWriter, user *models.User, password string) error {
+	err := checkRateLimit(w, u.RateLimiter, loginFailureKey(user.Email), LoginFailureLimit)
+	if err != nil {
+		if errors.Is(err, models.ErrRateLimited) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			fmt.Println(err)
+		}
+		return err
+	}
+
+	_, err = u.UserService.Authenticate(user.Email, password)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			u.recordLoginFailure(user.Email)
+			return errors.Public(err, "The current password you entered is incorrect.")
+		}
+
+		fmt.Println(err)
+		return err
+	}
+
+	u.resetLoginFailures(user.Email)
+
+	return nil
+}
+
+func publicPasswordError(err error) error {
+	var pwErr models.PasswordError
+	if errors.As(err, &pwErr) {
+		return errors.Public(err, fmt.Sprintf("This password can't be used: %v.", pwErr.Issue))
+	}
+
+	return err
+}
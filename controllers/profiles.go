@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (u Users) Profile(w http.ResponseWriter, r *http.Request) {
+	profile, err := u.userByHandle(w, r)
+	if err != nil {
+		return
+	}
+
+	type Gallery struct {
+		ID        int
+		Title     string
+		CreatedAt string
+	}
+	var data struct {
+		Handle      string
+		DisplayName string
+		Bio         string
+		AvatarHash  string
+		Galleries   []Gallery
+		Followers   int
+		Following   int
+		LoggedIn    bool
+		IsSelf      bool
+		Follows     bool
+	}
+	data.Handle = profile.Handle
+	data.DisplayName = profile.DisplayName
+	data.Bio = profile.Bio
+	data.AvatarHash = profile.AvatarHash
+
+	data.Followers, data.Following, err = u.FollowService.Counts(profile.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	user := context.User(r.Context())
+	if user != nil {
+		data.LoggedIn = true
+		data.IsSelf = user.ID == profile.ID
+
+		data.Follows, err = u.FollowService.IsFollowing(user.ID, profile.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	galleries, err := u.GalleryService.ByUserID(profile.ID, "created_at", "desc")
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, gallery := range galleries {
+		data.Galleries = append(data.Galleries, Gallery{
+			ID:        gallery.ID,
+			Title:     gallery.Title,
+			CreatedAt: gallery.CreatedAt.Format("January 02, 2006 15:04"),
+		})
+	}
+
+	u.Templates.Profile.Execute(w, r, data)
+}
+
+func (u Users) Follow(w http.ResponseWriter, r *http.Request) {
+	profile, err := u.userByHandle(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = u.FollowService.Follow(user.ID, profile.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrFollowSelf) {
+			http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+profile.Handle, http.StatusFound)
+}
+
+func (u Users) Unfollow(w http.ResponseWriter, r *http.Request) {
+	profile, err := u.userByHandle(w, r)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = u.FollowService.Unfollow(user.ID, profile.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+profile.Handle, http.StatusFound)
+}
+
+func (u Users) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	profile := *user
+	profile.Handle = r.FormValue("handle")
+	profile.DisplayName = r.FormValue("display_name")
+	profile.Bio = r.FormValue("bio")
+
+	err := u.UserService.UpdateProfile(&profile)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidHandle):
+			msg := fmt.Sprintf("Handles must be %d to %d characters long and may only contain lowercase letters, digits and underscores", models.MinHandleLength, models.MaxHandleLength)
+			err = errors.Public(err, msg)
+		case errors.Is(err, models.ErrHandleTaken):
+			err = errors.Public(err, "This handle is already taken. Please try another.")
+		case errors.Is(err, models.ErrProfileTooLong):
+			msg := fmt.Sprintf("Display names can be at most %d characters and bios at most %d characters long", models.MaxDisplayNameLength, models.MaxBioLength)
+			err = errors.Public(err, msg)
+		default:
+			fmt.Println(err)
+		}
+
+		u.renderMe(w, r, profile, err)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Profile updated")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	err := r.ParseMultipartForm(5 << 20)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, "Choose an image to upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	err = u.GalleryService.SetAvatar(user.ID, file)
+	if err != nil {
+		var fileErr models.FileError
+		if errors.As(err, &fileErr) {
+			msg := fmt.Sprintf("The avatar is not a valid image: %v", fileErr.Issue)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Avatar updated")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	err := u.GalleryService.RemoveAvatar(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Avatar removed")
+	http.Redirect(w, r, "/users/me", http.StatusFound)
+}
+
+func (u Users) Avatar(w http.ResponseWriter, r *http.Request) {
+	profile, err := u.userByHandle(w, r)
+	if err != nil {
+		return
+	}
+
+	if profile.AvatarHash == "" {
+		http.Redirect(w, r, "/assets/avatar.svg", http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", strconv.Quote(profile.AvatarHash))
+	w.Header().Set("Content-Type", "image/webp")
+
+	serveImage(w, r, "avatar.webp", u.GalleryService.AvatarPath(profile.AvatarHash), time.Time{})
+}
+
+func (u Users) userByHandle(w http.ResponseWriter, r *http.Request) (*models.User, error) {
+	user, err := u.UserService.ByHandle(chi.URLParam(r, "handle"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return nil, err
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	return user, nil
+}
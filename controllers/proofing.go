@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) UpdateProofing(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	limit, err := formInt(r, "limit", 0)
+	if err != nil {
+		http.Error(w, "Invalid selection limit", http.StatusBadRequest)
+		return
+	}
+
+	err = g.ProofingService.Configure(gallery.ID, r.FormValue("proofing") == "on", limit)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidProofingLimit) {
+			msg := fmt.Sprintf("The selection limit must be between 0 and %d", models.MaxProofingLimit)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Proofing settings updated")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) SelectProof(w http.ResponseWriter, r *http.Request) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleViewer), requireProofing)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = g.ProofingService.Select(gallery, user.ID, filename, r.FormValue("note"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrProofingLimit):
+			setCookie(w, CookieFlash, fmt.Sprintf("You can select at most %d images", gallery.ProofingLimit))
+			http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+		case errors.Is(err, models.ErrProofNoteTooLong):
+			msg := fmt.Sprintf("Notes can be at most %d characters long", models.MaxProofNoteLength)
+			http.Error(w, msg, http.StatusBadRequest)
+		default:
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+}
+
+func (g Galleries) DeselectProof(w http.ResponseWriter, r *http.Request) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleViewer), requireProofing)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = g.ProofingService.Deselect(gallery.ID, user.ID, filename)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+}
+
+func (g Galleries) SubmitProofing(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleViewer), requireProofing)
+	if err != nil {
+		return
+	}
+
+	user := context.User(r.Context())
+
+	selection, err := g.ProofingService.Submit(gallery.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			setCookie(w, CookieFlash, "Select at least one image before submitting")
+			http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	owners, err := g.MemberService.OwnerEmails(gallery.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	reviewURL := fmt.Sprintf("https://www.galaria.com/galleries/%d/edit", gallery.ID)
+
+	for _, owner := range owners {
+		err = g.EmailService.ProofingSubmitted(owner, user.Email, gallery.Title, len(selection.Images), reviewURL)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	setCookie(w, CookieFlash, fmt.Sprintf("Your selection of %d images was sent to the photographer", len(selection.Images)))
+	http.Redirect(w, r, fmt.Sprintf("/galleries/%d", gallery.ID), http.StatusFound)
+}
+
+func (g Galleries) ExportProofing(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleEditor))
+	if err != nil {
+		return
+	}
+
+	selectionID, err := strconv.Atoi(chi.URLParam(r, "selectionID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	selection, err := g.ProofingService.ByID(gallery.ID, selectionID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	var names []string
+	for _, image := range selection.Images {
+		names = append(names, strings.TrimSuffix(image.Filename, filepath.Ext(image.Filename)))
+	}
+
+	filename := fmt.Sprintf("selection-%d-%d.txt", gallery.ID, selection.ID)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	fmt.Fprintln(w, strings.Join(names, ", "))
+}
+
+func requireProofing(w http.ResponseWriter, r *http.Request, gallery *models.Gallery) error {
+	if !gallery.Proofing {
+		http.NotFound(w, r)
+		return fmt.Errorf("gallery %d is not in proofing mode", gallery.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ProxyMiddleware struct {
+	TrustedProxies []netip.Prefix
+}
+
+// SetRealIP replaces the request's RemoteAddr with the client address
+// reported in X-Forwarded-For, but only when the request came from a trusted
+// proxy. The header is read from the right, skipping trusted hops, so a
+// client can't spoof its address by sending the header itself.
+func (pmw ProxyMiddleware) SetRealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := pmw.forwardedFor(r); ok {
+			r.RemoteAddr = ip.String()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (pmw ProxyMiddleware) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	remote, err := netip.ParseAddr(clientIP(r))
+	if err != nil || !pmw.trusted(remote) {
+		return netip.Addr{}, false
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+
+		if !pmw.trusted(hop) {
+			return hop, true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+func (pmw ProxyMiddleware) trusted(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	for _, prefix := range pmw.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// prefixes.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			ip, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, err
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
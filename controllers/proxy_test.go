@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyMiddlewareSetRealIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("172.16.0.0/12, 10.0.0.1")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() err = %v", err)
+	}
+	pmw := ProxyMiddleware{TrustedProxies: proxies}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.7:5555", nil, "203.0.113.7"},
+		{"untrusted client sending the header", "203.0.113.7:5555", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "172.18.0.3:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"trusted proxy with spoofed hops", "172.18.0.3:4000", []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"chained trusted proxies", "172.18.0.3:4000", []string{"203.0.113.7", "10.0.0.1"}, "203.0.113.7"},
+		{"trusted proxy without header", "172.18.0.3:4000", nil, "172.18.0.3"},
+		{"trusted proxy with garbage", "172.18.0.3:4000", []string{"not-an-ip"}, "172.18.0.3"},
+		{"ipv4 mapped proxy", "[::ffff:172.18.0.3]:4000", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			var got string
+			pmw.SetRealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"10.0.0.1", 1, false},
+		{"10.0.0.0/8, ::1, 172.16.0.0/12", 3, false},
+		{"10.0.0.300", 0, true},
+		{"10.0.0.0/40", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTrustedProxies(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTrustedProxies(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if len(got) != tt.want {
+			t.Errorf("ParseTrustedProxies(%q) = %v, want %d prefixes", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+)
+
+var (
+	LoginLimit               = models.RateLimit{Requests: 20, Window: 15 * time.Minute}
+	LoginFailureLimit        = models.RateLimit{Requests: 5, Window: 15 * time.Minute}
+	RegisterLimit            = models.RateLimit{Requests: 5, Window: time.Hour}
+	ForgotPasswordLimit      = models.RateLimit{Requests: 5, Window: time.Hour}
+	ForgotPasswordEmailLimit = models.RateLimit{Requests: 3, Window: time.Hour}
+	LoginLinkLimit           = models.RateLimit{Requests: 5, Window: time.Hour}
+	LoginLinkEmailLimit      = models.RateLimit{Requests: 3, Window: 15 * time.Minute}
+	UploadLimit              = models.RateLimit{Requests: 60, Window: time.Hour}
+)
+
+func takeRateLimit(w http.ResponseWriter, limiter models.RateLimiter, key string, limit models.RateLimit) error {
+	if limiter == nil {
+		return nil
+	}
+
+	wait, err := limiter.Take(key, limit)
+	if err != nil {
+		return err
+	}
+
+	return rateLimitError(w, key, wait)
+}
+
+func checkRateLimit(w http.ResponseWriter, limiter models.RateLimiter, key string, limit models.RateLimit) error {
+	if limiter == nil {
+		return nil
+	}
+
+	wait, err := limiter.Check(key, limit)
+	if err != nil {
+		return err
+	}
+
+	return rateLimitError(w, key, wait)
+}
+
+func rateLimitError(w http.ResponseWriter, key string, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	err := fmt.Errorf("rate limit %s: %w", key, models.ErrRateLimited)
+	msg := fmt.Sprintf("Too many attempts. Please try again in %s.", formatWait(wait))
+
+	return errors.Public(err, msg)
+}
+
+func writeRateLimitError(w http.ResponseWriter, err error) {
+	if !errors.Is(err, models.ErrRateLimited) {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	var pubErr interface{ Public() string }
+	if errors.As(err, &pubErr) {
+		http.Error(w, pubErr.Public(), http.StatusTooManyRequests)
+		return
+	}
+
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+func formatWait(wait time.Duration) string {
+	if wait <= time.Minute {
+		return "a minute"
+	}
+
+	return fmt.Sprintf("%d minutes", int(math.Ceil(wait.Minutes())))
+}
+
+func loginFailureKey(email string) string {
+	return "login-failures:" + strings.ToLower(strings.TrimSpace(email))
+}
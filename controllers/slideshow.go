@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alexandru-calin/galaria/models"
+)
+
+const (
+	defaultSlideshowInterval = 5
+	minSlideshowInterval     = 1
+	maxSlideshowInterval     = 60
+	eventsHeartbeat          = 30 * time.Second
+)
+
+var slideshowTransitions = []string{"fade", "slide", "none"}
+
+func (g Galleries) Slideshow(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	interval, err := strconv.Atoi(r.FormValue("interval"))
+	if err != nil {
+		interval = defaultSlideshowInterval
+	}
+	interval = min(max(interval, minSlideshowInterval), maxSlideshowInterval)
+
+	transition := r.FormValue("transition")
+	if !slices.Contains(slideshowTransitions, transition) {
+		transition = slideshowTransitions[0]
+	}
+
+	var data struct {
+		ID         int
+		Title      string
+		Images     []string
+		Interval   int
+		Transition string
+	}
+	data.ID = gallery.ID
+	data.Title = gallery.Title
+	data.Interval = interval
+	data.Transition = transition
+
+	images, err := g.GalleryService.Images(gallery.ID, models.ImageFilter{Order: "asc"})
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, image := range images {
+		data.Images = append(data.Images, imageURL(gallery.ID, image.Filename))
+	}
+
+	g.Templates.Slideshow.Execute(w, r, data)
+}
+
+func (g Galleries) Events(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r)
+	if err != nil {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok || g.GalleryService.Events == nil {
+		http.Error(w, "Live updates are not supported", http.StatusNotImplemented)
+		return
+	}
+
+	events, unsubscribe := g.GalleryService.Events.Subscribe(gallery.ID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			payload, err := json.Marshal(struct {
+				Filename string `json:"filename"`
+				URL      string `json:"url"`
+			}{
+				Filename: event.Filename,
+				URL:      imageURL(event.GalleryID, event.Filename),
+			})
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			fmt.Fprintf(w, "event: image\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+func imageURL(galleryID int, filename string) string {
+	return fmt.Sprintf("/galleries/%d/images/%s", galleryID, url.PathEscape(filename))
+}
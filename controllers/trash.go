@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) Trash(w http.ResponseWriter, r *http.Request) {
+	type Gallery struct {
+		ID        int
+		Title     string
+		DeletedAt string
+		ExpiresAt string
+	}
+	type Image struct {
+		GalleryID       int
+		GalleryTitle    string
+		Filename        string
+		FilenameEscaped string
+		Size            string
+		DeletedAt       string
+		ExpiresAt       string
+	}
+	var data struct {
+		Galleries []Gallery
+		Images    []Image
+		Flash     string
+	}
+
+	user := context.User(r.Context())
+
+	trash, err := g.GalleryService.Trash(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	for _, gallery := range trash.Galleries {
+		data.Galleries = append(data.Galleries, Gallery{
+			ID:        gallery.ID,
+			Title:     gallery.Title,
+			DeletedAt: gallery.DeletedAt.Format("01-02-2006 15:04"),
+			ExpiresAt: g.GalleryService.ExpiresAt(gallery.DeletedAt).Format("01-02-2006 15:04"),
+		})
+	}
+
+	for _, image := range trash.Images {
+		data.Images = append(data.Images, Image{
+			GalleryID:       image.GalleryID,
+			GalleryTitle:    image.GalleryTitle,
+			Filename:        image.Filename,
+			FilenameEscaped: url.PathEscape(image.Filename),
+			Size:            formatBytes(image.Size),
+			DeletedAt:       image.DeletedAt.Format("01-02-2006 15:04"),
+			ExpiresAt:       g.GalleryService.ExpiresAt(image.DeletedAt).Format("01-02-2006 15:04"),
+		})
+	}
+
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
+	g.Templates.Trash.Execute(w, r, data)
+}
+
+func (g Galleries) RestoreGallery(w http.ResponseWriter, r *http.Request) {
+	g.trashAction(w, r, g.GalleryService.Restore, "Gallery restored successfully")
+}
+
+func (g Galleries) PurgeGallery(w http.ResponseWriter, r *http.Request) {
+	g.trashAction(w, r, g.GalleryService.Purge, "Gallery deleted permanently")
+}
+
+func (g Galleries) RestoreImage(w http.ResponseWriter, r *http.Request) {
+	g.trashImageAction(w, r, g.GalleryService.RestoreImage, "Image restored successfully")
+}
+
+func (g Galleries) PurgeImage(w http.ResponseWriter, r *http.Request) {
+	g.trashImageAction(w, r, g.GalleryService.PurgeImage, "Image deleted permanently")
+}
+
+func (g Galleries) trashAction(w http.ResponseWriter, r *http.Request, action func(userID, id int) error, flash string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	user := context.User(r.Context())
+
+	err = action(user.ID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			http.Error(w, "Restoring this would exceed your storage quota", http.StatusForbidden)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, flash)
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
+
+func (g Galleries) trashImageAction(w http.ResponseWriter, r *http.Request, action func(galleryID int, filename string) error, flash string) {
+	filename := filepath.Base(chi.URLParam(r, "filename"))
+
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	err = action(gallery.ID, filename)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			http.Error(w, "Restoring this would exceed your storage quota", http.StatusForbidden)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	err = g.GalleryService.Update(gallery)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, flash)
+
+	http.Redirect(w, r, "/trash", http.StatusFound)
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alexandru-calin/galaria/context"
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func (g Galleries) CreateUploadLink(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	maxFiles, err := formInt(r, "max_files", models.DefaultUploadLinkFiles)
+	if err != nil {
+		http.Error(w, "Invalid number of files", http.StatusBadRequest)
+		return
+	}
+
+	maxMegabytes, err := formInt(r, "max_mb", models.DefaultUploadLinkBytes>>20)
+	if err != nil {
+		http.Error(w, "Invalid file size", http.StatusBadRequest)
+		return
+	}
+
+	days, err := formInt(r, "days", int(models.DefaultUploadLinkDuration/(24*time.Hour)))
+	if err != nil {
+		http.Error(w, "Invalid expiry", http.StatusBadRequest)
+		return
+	}
+
+	user := context.User(r.Context())
+
+	link, err := g.UploadLinkService.Create(gallery.ID, user.ID, r.FormValue("label"),
+		maxFiles, int64(maxMegabytes)<<20, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidUploadLink) {
+			msg := fmt.Sprintf("Upload links accept at most %d files of up to %d MB and expire within %d days",
+				models.MaxUploadLinkFiles, models.MaxUploadLinkBytes>>20, int(models.MaxUploadLinkDuration/(24*time.Hour)))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	uploadURL := "https://www.galaria.com/upload/" + url.PathEscape(link.Token)
+	setCookie(w, CookieFlash, "Upload link created, share it with your guests: "+uploadURL)
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) DeleteUploadLink(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByID(w, r, g.requireRole(models.RoleOwner))
+	if err != nil {
+		return
+	}
+
+	linkID, err := strconv.Atoi(chi.URLParam(r, "linkID"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	err = g.UploadLinkService.Delete(gallery.ID, linkID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, CookieFlash, "Upload link deleted")
+
+	editPath := fmt.Sprintf("/galleries/%d/edit", gallery.ID)
+	http.Redirect(w, r, editPath, http.StatusFound)
+}
+
+func (g Galleries) GuestUpload(w http.ResponseWriter, r *http.Request) {
+	link, gallery, err := g.uploadLinkByToken(w, r)
+	if err != nil {
+		return
+	}
+
+	var data struct {
+		Token     string
+		Title     string
+		Label     string
+		Remaining int
+		MaxSize   string
+		ExpiresAt string
+		Flash     string
+	}
+	data.Token = link.Token
+	data.Title = gallery.Title
+	data.Label = link.Label
+	data.Remaining = link.Remaining()
+	data.MaxSize = formatBytes(link.MaxBytes)
+	data.ExpiresAt = link.ExpiresAt.Format("January 02, 2006 15:04")
+
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
+	g.Templates.Upload.Execute(w, r, data)
+}
+
+func (g Galleries) ProcessGuestUpload(w http.ResponseWriter, r *http.Request) {
+	link, _, err := g.uploadLinkByToken(w, r)
+	if err != nil {
+		return
+	}
+
+	err = takeRateLimit(w, g.RateLimiter, "upload:ip:"+clientIP(r), UploadLimit)
+	if err != nil {
+		writeRateLimitError(w, err)
+		return
+	}
+
+	// Guests send one image per request, so anonymous requests never buffer
+	// more than one file's worth of data.
+	r.Body = http.MaxBytesReader(w, r.Body, link.MaxBytes+1<<20)
+
+	err = r.ParseMultipartForm(5 << 20)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			msg := fmt.Sprintf("Images are limited to %v each", formatBytes(link.MaxBytes))
+			http.Error(w, msg, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+
+	fileHeaders := r.MultipartForm.File["images"]
+	if len(fileHeaders) == 0 {
+		http.Error(w, "No images selected", http.StatusBadRequest)
+		return
+	}
+
+	if len(fileHeaders) > 1 {
+		http.Error(w, "Please upload one image at a time", http.StatusBadRequest)
+		return
+	}
+
+	if len(fileHeaders) > link.Remaining() {
+		msg := fmt.Sprintf("This link accepts %d more images", link.Remaining())
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	for _, fileHeader := range fileHeaders {
+		if fileHeader.Size > link.MaxBytes {
+			msg := fmt.Sprintf("%v is larger than %v", fileHeader.Filename, formatBytes(link.MaxBytes))
+			http.Error(w, msg, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		err = g.GalleryService.CreateGuestImage(link, fileHeader.Filename, r.FormValue("name"), file)
+		if err != nil {
+			var fileErr models.FileError
+			if errors.As(err, &fileErr) {
+				msg := fmt.Sprintf("%v is not a valid image: %v", fileHeader.Filename, fileErr.Issue)
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				http.Error(w, "This gallery cannot accept more images", http.StatusForbidden)
+				return
+			}
+
+			if errors.Is(err, models.ErrUploadLinkExhausted) {
+				http.Error(w, "This upload link has expired or reached its limit", http.StatusForbidden)
+				return
+			}
+
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	setCookie(w, CookieFlash, fmt.Sprintf("Thank you! %d images were sent to the gallery owner for review", len(fileHeaders)))
+
+	uploadPath := "/upload/" + url.PathEscape(link.Token)
+	http.Redirect(w, r, uploadPath, http.StatusFound)
+}
+
+func (g Galleries) uploadLinkByToken(w http.ResponseWriter, r *http.Request) (*models.UploadLink, *models.Gallery, error) {
+	link, err := g.UploadLinkService.ByToken(chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This upload link is invalid or has expired", http.StatusNotFound)
+			return nil, nil, err
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return nil, nil, err
+	}
+
+	gallery, err := g.GalleryService.ByID(link.GalleryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "This upload link is invalid or has expired", http.StatusNotFound)
+			return nil, nil, err
+		}
+
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return nil, nil, err
+	}
+
+	return link, gallery, nil
+}
+
+func formInt(r *http.Request, key string, fallback int) (int, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value)
+}
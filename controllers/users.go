@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/alexandru-calin/galaria/context"
 	"github.com/alexandru-calin/galaria/errors"
@@ -18,27 +19,106 @@ type Users struct {
 		ForgotPassword Template
 		CheckYourEmail Template
 		ResetPassword  Template
+		EmailChange    Template
 		Me             Template
+		Profile        Template
 	}
 	UserService          *models.UserService
 	GalleryService       *models.GalleryService
 	SessionService       *models.SessionService
 	PasswordResetService *models.PasswordResetService
 	EmailService         *models.EmailService
+	OrganizationService  *models.OrganizationService
+	FollowService        *models.FollowService
+	EmailChangeService   *models.EmailChangeService
+	LoginLinkService     *models.LoginLinkService
+	IdentityService      *models.IdentityService
+	OIDCProviders        []*models.OIDCProvider
+	RateLimiter          models.RateLimiter
 }
 
 func (u Users) Home(w http.ResponseWriter, r *http.Request) {
 	type Gallery struct {
-		ID        int
-		Title     string
-		CreatedAt string
-		UpdatedAt string
+		ID          int
+		Title       string
+		Likes       int
+		OwnerHandle string
+		OwnerName   string
+		CreatedAt   string
+		UpdatedAt   string
+	}
+	type FeedImage struct {
+		Filename        string
+		FilenameEscaped string
+	}
+	type FeedItem struct {
+		Kind         string
+		GalleryID    int
+		GalleryTitle string
+		Handle       string
+		Author       string
+		Images       int
+		Previews     []FeedImage
+		At           string
 	}
 	var data struct {
 		Galleries []Gallery
+		Sort      string
+		LoggedIn  bool
+		Feed      []FeedItem
+		Page      int
+		PrevPage  int
+		NextPage  int
 	}
+	data.Sort = r.FormValue("sort")
+
+	user := context.User(r.Context())
+	if user != nil {
+		page, err := formInt(r, "page", 1)
+		if err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+
+		items, more, err := u.FollowService.Feed(user.ID, page)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
 
-	galleries, err := u.GalleryService.Latest()
+		for _, item := range items {
+			feedItem := FeedItem{
+				Kind:         string(item.Kind),
+				GalleryID:    item.GalleryID,
+				GalleryTitle: item.GalleryTitle,
+				Handle:       item.Handle,
+				Author:       item.Author,
+				Images:       item.Images,
+				At:           item.At.Format("January 02, 2006 15:04"),
+			}
+
+			for _, filename := range item.Filenames {
+				feedItem.Previews = append(feedItem.Previews, FeedImage{
+					Filename:        filename,
+					FilenameEscaped: url.PathEscape(filename),
+				})
+			}
+
+			data.Feed = append(data.Feed, feedItem)
+		}
+
+		data.LoggedIn = true
+		data.Page = page
+		if page > 1 {
+			data.PrevPage = page - 1
+		}
+		if more {
+			data.NextPage = page + 1
+		}
+	}
+
+	galleries, err := u.GalleryService.Latest(data.Sort)
 	if err != nil {
 		fmt.Println(err)
 		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
@@ -47,10 +127,13 @@ func (u Users) Home(w http.ResponseWriter, r *http.Request) {
 
 	for _, gallery := range galleries {
 		data.Galleries = append(data.Galleries, Gallery{
-			ID:        gallery.ID,
-			Title:     gallery.Title,
-			CreatedAt: gallery.CreatedAt.Format("January 02, 2006 15:04"),
-			UpdatedAt: gallery.UpdatedAt.Format("January 02, 2006 15:04"),
+			ID:          gallery.ID,
+			Title:       gallery.Title,
+			Likes:       gallery.Likes,
+			OwnerHandle: gallery.OwnerHandle,
+			OwnerName:   gallery.OwnerName,
+			CreatedAt:   gallery.CreatedAt.Format("January 02, 2006 15:04"),
+			UpdatedAt:   gallery.UpdatedAt.Format("January 02, 2006 15:04"),
 		})
 	}
 
@@ -75,12 +158,27 @@ func (u Users) Create(w http.ResponseWriter, r *http.Request) {
 	data.Email = r.FormValue("email")
 	data.Password = r.FormValue("password")
 
+	err := takeRateLimit(w, u.RateLimiter, "register:"+clientIP(r), RegisterLimit)
+	if err != nil {
+		if errors.Is(err, models.ErrRateLimited) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		u.Templates.New.Execute(w, r, data, err)
+		return
+	}
+
 	user, err := u.UserService.Create(data.Email, data.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrEmailTaken) {
 			msg := "This email address is already taken. Please try another."
 			err = errors.Public(err, msg)
 		}
+		if errors.Is(err, models.ErrWeakPassword) {
+			err = publicPasswordError(err)
+		}
 		u.Templates.New.Execute(w, r, data, err)
 		return
 	}
@@ -92,7 +190,7 @@ func (u Users) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flash := fmt.Sprintf("Successfully registered and logged in as %s", data.Email)
+	flash := fmt.Sprintf("Successfully registered and logged in as %s. Pick a public handle for your profile on your account page.", data.Email)
 
 	setCookie(w, CookieSession, session.Token)
 	setCookie(w, CookieFlash, flash)
@@ -108,27 +206,50 @@ func (u Users) Login(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
 			return
 		}
-		u.Templates.Login.Execute(w, r, nil)
+		u.renderLogin(w, r, "")
 		return
 	}
 
+	deleteCookie(w, CookieFlash)
+
+	u.renderLogin(w, r, flash)
+}
+
+func (u Users) renderLogin(w http.ResponseWriter, r *http.Request, flash string, errs ...error) {
 	var data struct {
-		Flash string
+		Flash     string
+		Providers []*models.OIDCProvider
 	}
 
 	data.Flash = flash
-	deleteCookie(w, CookieFlash)
+	data.Providers = u.OIDCProviders
 
-	u.Templates.Login.Execute(w, r, data)
+	u.Templates.Login.Execute(w, r, data, errs...)
 }
 
 func (u Users) ProcessLogin(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
+	err := takeRateLimit(w, u.RateLimiter, "login:"+clientIP(r), LoginLimit)
+	if err == nil {
+		err = checkRateLimit(w, u.RateLimiter, loginFailureKey(email), LoginFailureLimit)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrRateLimited) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Println(err)
+		u.renderLogin(w, r, "", err)
+		return
+	}
+
 	user, err := u.UserService.Authenticate(email, password)
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
+			u.recordLoginFailure(email)
 			w.WriteHeader(http.StatusBadRequest)
 			msg := "Incorrect email or password."
 			err = errors.Public(err, msg)
@@ -136,10 +257,12 @@ func (u Users) ProcessLogin(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 		fmt.Println(err)
-		u.Templates.Login.Execute(w, r, nil, err)
+		u.renderLogin(w, r, "", err)
 		return
 	}
 
+	u.resetLoginFailures(email)
+
 	session, err := u.SessionService.Create(user.ID)
 	if err != nil {
 		fmt.Println(err)
@@ -154,6 +277,28 @@ func (u Users) ProcessLogin(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/galleries", http.StatusFound)
 }
 
+func (u Users) recordLoginFailure(email string) {
+	if u.RateLimiter == nil {
+		return
+	}
+
+	_, err := u.RateLimiter.Take(loginFailureKey(email), LoginFailureLimit)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func (u Users) resetLoginFailures(email string) {
+	if u.RateLimiter == nil {
+		return
+	}
+
+	err := u.RateLimiter.Reset(loginFailureKey(email))
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
 func (u Users) ProcessLogout(w http.ResponseWriter, r *http.Request) {
 	token, err := readCookie(r, CookieSession)
 	if err != nil {
@@ -180,6 +325,21 @@ func (u Users) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 func (u Users) ProcessForgotPassword(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 
+	err := takeRateLimit(w, u.RateLimiter, "forgot-password:"+clientIP(r), ForgotPasswordLimit)
+	if err == nil {
+		err = takeRateLimit(w, u.RateLimiter, "forgot-password-email:"+strings.ToLower(strings.TrimSpace(email)), ForgotPasswordEmailLimit)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrRateLimited) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			fmt.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		u.Templates.ForgotPassword.Execute(w, r, nil, err)
+		return
+	}
+
 	pwReset, err := u.PasswordResetService.Create(email)
 	if err != nil {
 		fmt.Println(err)
@@ -215,6 +375,17 @@ func (u Users) ProcessResetPassword(w http.ResponseWriter, r *http.Request) {
 	token := r.FormValue("token")
 	password := r.FormValue("password")
 
+	err := u.UserService.ValidatePassword(password)
+	if err != nil {
+		var data struct {
+			Token string
+		}
+		data.Token = token
+
+		u.Templates.ResetPassword.Execute(w, r, data, publicPasswordError(err))
+		return
+	}
+
 	user, err := u.PasswordResetService.Consume(token)
 	if err != nil {
 		fmt.Println(err)
@@ -241,7 +412,91 @@ func (u Users) ProcessResetPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u Users) Me(w http.ResponseWriter, r *http.Request) {
-	u.Templates.Me.Execute(w, r, nil)
+	u.renderMe(w, r, *context.User(r.Context()))
+}
+
+func (u Users) renderMe(w http.ResponseWriter, r *http.Request, profile models.User, errs ...error) {
+	var data struct {
+		Handle      string
+		DisplayName string
+		Bio         string
+		AvatarHash  string
+		Flash       string
+
+		Images        int
+		UploadedBytes string
+		StoredBytes   string
+		SavedBytes    string
+		HasPassword   bool
+		Accounts      []oidcAccount
+		Usage         struct {
+			Bytes        string
+			Images       int
+			QuotaBytes   string
+			QuotaImages  int
+			BytesPercent int
+		}
+	}
+
+	user := context.User(r.Context())
+
+	data.Handle = profile.Handle
+	data.DisplayName = profile.DisplayName
+	data.Bio = profile.Bio
+	data.AvatarHash = user.AvatarHash
+	data.HasPassword = user.PasswordHash != ""
+
+	if len(u.OIDCProviders) > 0 {
+		identities, err := u.IdentityService.ByUser(user.ID)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+
+		data.Accounts = oidcAccounts(u.OIDCProviders, identities)
+	}
+
+	report, err := u.GalleryService.StorageReport(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	data.Images = report.Images
+	data.UploadedBytes = formatBytes(report.UploadedBytes)
+	data.StoredBytes = formatBytes(report.StoredBytes)
+	data.SavedBytes = formatBytes(report.SavedBytes())
+
+	usage, err := u.GalleryService.Usage(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
+	data.Usage.Bytes = formatBytes(usage.Bytes)
+	data.Usage.Images = usage.Images
+	data.Usage.QuotaImages = usage.Quota.Images
+	if usage.Quota.Bytes > 0 {
+		data.Usage.QuotaBytes = formatBytes(usage.Quota.Bytes)
+		data.Usage.BytesPercent = int(min(100, usage.Bytes*100/usage.Quota.Bytes))
+	}
+
+	flash, err := readCookie(r, CookieFlash)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			fmt.Println(err)
+			http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data.Flash = flash
+	deleteCookie(w, CookieFlash)
+
+	u.Templates.Me.Execute(w, r, data, errs...)
 }
 
 func (u Users) Delete(w http.ResponseWriter, r *http.Request) {
@@ -254,6 +509,13 @@ func (u Users) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = u.GalleryService.RemoveAvatar(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Oops, something went wrong...", http.StatusInternalServerError)
+		return
+	}
+
 	err = u.UserService.Delete(user.ID)
 	if err != nil {
 		fmt.Println(err)
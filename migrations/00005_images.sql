@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE blobs (
+    hash TEXT PRIMARY KEY,
+    size BIGINT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE images (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL REFERENCES galleries (id),
+    filename TEXT NOT NULL,
+    blob_hash TEXT NOT NULL REFERENCES blobs (hash),
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    UNIQUE (gallery_id, filename)
+);
+
+CREATE INDEX images_blob_hash_idx ON images (blob_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE images;
+DROP TABLE blobs;
+-- +goose StatementEnd
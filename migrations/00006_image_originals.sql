@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE images ADD COLUMN original_hash TEXT REFERENCES blobs (hash);
+
+CREATE INDEX images_original_hash_idx ON images (original_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images DROP COLUMN original_hash;
+-- +goose StatementEnd
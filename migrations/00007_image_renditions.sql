@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE image_renditions (
+    image_id INT NOT NULL REFERENCES images (id),
+    content_type TEXT NOT NULL,
+    blob_hash TEXT NOT NULL REFERENCES blobs (hash),
+    PRIMARY KEY (image_id, content_type)
+);
+
+CREATE INDEX image_renditions_blob_hash_idx ON image_renditions (blob_hash);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE image_renditions;
+-- +goose StatementEnd
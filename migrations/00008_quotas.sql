@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN quota_bytes BIGINT,
+ADD COLUMN quota_images INT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN quota_bytes,
+DROP COLUMN quota_images;
+-- +goose StatementEnd
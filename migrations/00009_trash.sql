@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE galleries ADD COLUMN deleted_at TIMESTAMPTZ(0);
+ALTER TABLE images ADD COLUMN deleted_at TIMESTAMPTZ(0);
+
+CREATE INDEX galleries_deleted_at_idx ON galleries (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX images_deleted_at_idx ON images (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images DROP COLUMN deleted_at;
+ALTER TABLE galleries DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE images ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE image_tags (
+    image_id INT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (image_id, tag)
+);
+
+CREATE INDEX image_tags_tag_idx ON image_tags (tag);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE image_tags;
+ALTER TABLE images DROP COLUMN caption;
+-- +goose StatementEnd
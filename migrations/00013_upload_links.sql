@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE upload_links (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL REFERENCES galleries (id) ON DELETE CASCADE,
+    created_by INT REFERENCES users (id) ON DELETE SET NULL,
+    label TEXT NOT NULL DEFAULT '',
+    token_hash TEXT UNIQUE NOT NULL,
+    max_files INT NOT NULL,
+    max_bytes BIGINT NOT NULL,
+    uploads INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE images ADD COLUMN pending BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE images ADD COLUMN uploaded_by TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX images_pending_idx ON images (gallery_id) WHERE pending;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images DROP COLUMN uploaded_by;
+ALTER TABLE images DROP COLUMN pending;
+DROP TABLE upload_links;
+-- +goose StatementEnd
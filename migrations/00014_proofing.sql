@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE galleries ADD COLUMN proofing BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE galleries ADD COLUMN proofing_limit INT NOT NULL DEFAULT 0 CHECK (proofing_limit >= 0);
+
+CREATE TABLE proof_selections (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL REFERENCES galleries (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    submitted_at TIMESTAMPTZ(0),
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    UNIQUE (gallery_id, user_id)
+);
+
+CREATE TABLE proof_images (
+    selection_id INT NOT NULL REFERENCES proof_selections (id) ON DELETE CASCADE,
+    image_id INT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (selection_id, image_id)
+);
+
+CREATE INDEX proof_images_image_id_idx ON proof_images (image_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE proof_images;
+DROP TABLE proof_selections;
+ALTER TABLE galleries DROP COLUMN proofing_limit;
+ALTER TABLE galleries DROP COLUMN proofing;
+-- +goose StatementEnd
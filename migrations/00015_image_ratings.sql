@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE images ADD COLUMN rating SMALLINT NOT NULL DEFAULT 0 CHECK (rating BETWEEN 0 AND 5);
+ALTER TABLE images ADD COLUMN flag TEXT NOT NULL DEFAULT '' CHECK (flag IN ('', 'pick', 'reject'));
+ALTER TABLE images ADD COLUMN label TEXT NOT NULL DEFAULT '' CHECK (label IN ('', 'red', 'yellow', 'green', 'blue', 'purple'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images DROP COLUMN label;
+ALTER TABLE images DROP COLUMN flag;
+ALTER TABLE images DROP COLUMN rating;
+-- +goose StatementEnd
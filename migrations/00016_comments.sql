@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE galleries ADD COLUMN comments TEXT NOT NULL DEFAULT 'disabled' CHECK (comments IN ('disabled', 'open', 'moderated'));
+ALTER TABLE galleries ALTER COLUMN comments SET DEFAULT 'open';
+
+CREATE TABLE comments (
+    id SERIAL PRIMARY KEY,
+    gallery_id INT NOT NULL REFERENCES galleries (id) ON DELETE CASCADE,
+    image_id INT REFERENCES images (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    approved BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX comments_gallery_id_idx ON comments (gallery_id, created_at);
+CREATE INDEX comments_user_id_idx ON comments (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE comments;
+ALTER TABLE galleries DROP COLUMN comments;
+-- +goose StatementEnd
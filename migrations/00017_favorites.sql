@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE gallery_favorites (
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    gallery_id INT NOT NULL REFERENCES galleries (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, gallery_id)
+);
+
+CREATE INDEX gallery_favorites_gallery_id_idx ON gallery_favorites (gallery_id);
+
+CREATE TABLE image_favorites (
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    image_id INT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, image_id)
+);
+
+CREATE INDEX image_favorites_image_id_idx ON image_favorites (image_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE image_favorites;
+DROP TABLE gallery_favorites;
+-- +goose StatementEnd
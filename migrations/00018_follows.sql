@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN handle TEXT;
+
+UPDATE users
+SET handle = 'user_' || lpad(floor(random() * 100000000)::int::text, 8, '0');
+
+DO $$
+BEGIN
+    LOOP
+        WITH ranked AS (
+            SELECT id, ROW_NUMBER() OVER (PARTITION BY handle ORDER BY id) AS n
+            FROM users
+        )
+        UPDATE users
+        SET handle = 'user_' || lpad(floor(random() * 100000000)::int::text, 8, '0')
+        FROM ranked
+        WHERE ranked.id = users.id AND ranked.n > 1;
+
+        EXIT WHEN NOT FOUND;
+    END LOOP;
+END $$;
+
+ALTER TABLE users ALTER COLUMN handle SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_handle_key UNIQUE (handle);
+
+CREATE TABLE follows (
+    follower_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    followee_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ(0) NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id);
+CREATE INDEX galleries_user_id_created_at_idx ON galleries (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX galleries_user_id_created_at_idx;
+DROP TABLE follows;
+ALTER TABLE users DROP COLUMN handle;
+-- +goose StatementEnd
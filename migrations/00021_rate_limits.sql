@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE rate_limit_hits (
+    key TEXT NOT NULL,
+    hit_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_hits_key_idx ON rate_limit_hits (key, hit_at);
+CREATE INDEX rate_limit_hits_hit_at_idx ON rate_limit_hits (hit_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE rate_limit_hits;
+-- +goose StatementEnd
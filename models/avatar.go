@@ -0,0 +1,156 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"golang.org/x/image/draw"
+)
+
+const (
+	AvatarSize = 256
+)
+
+func (gs *GalleryService) SetAvatar(userID int, contents io.ReadSeeker) error {
+	err := checkContentType(contents, gs.imageContentTypes())
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	decoded, err := gs.decodeImage(contents)
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	src := decoded.img
+	if decoded.anim != nil {
+		src = decoded.anim.Image[0]
+	}
+
+	var buf bytes.Buffer
+
+	err = encodeWebP(&buf, cropSquare(src, AvatarSize))
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	blob, err := gs.writeTempBlob(&buf)
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+	defer os.Remove(blob.path)
+
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous, err := lockAvatar(tx, userID)
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	err = gs.retainBlob(tx, blob)
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET avatar_hash=$2
+		WHERE id=$1`, userID, blob.hash)
+
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	err = gs.releaseBlobs(tx, previous)
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("setting avatar: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) RemoveAvatar(userID int) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("removing avatar: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous, err := lockAvatar(tx, userID)
+	if err != nil {
+		return fmt.Errorf("removing avatar: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET avatar_hash=NULL
+		WHERE id=$1`, userID)
+
+	if err != nil {
+		return fmt.Errorf("removing avatar: %w", err)
+	}
+
+	err = gs.releaseBlobs(tx, previous)
+	if err != nil {
+		return fmt.Errorf("removing avatar: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("removing avatar: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) AvatarPath(hash string) string {
+	return gs.blobPath(hash)
+}
+
+func lockAvatar(tx *sql.Tx, userID int) (string, error) {
+	var hash sql.NullString
+
+	row := tx.QueryRow(`
+		SELECT avatar_hash FROM users
+		WHERE id=$1 FOR UPDATE`, userID)
+
+	err := row.Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+
+		return "", err
+	}
+
+	return hash.String, nil
+}
+
+func cropSquare(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	return dst
+}
@@ -0,0 +1,340 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+const (
+	DefaultBlobsDir        = "blobs"
+	DefaultBlobGracePeriod = time.Hour
+)
+
+type StorageReport struct {
+	Images        int
+	UploadedBytes int64
+	StoredBytes   int64
+}
+
+func (sr StorageReport) SavedBytes() int64 {
+	return sr.UploadedBytes - sr.StoredBytes
+}
+
+func (gs *GalleryService) StorageReport(userID int) (*StorageReport, error) {
+	var report StorageReport
+
+	row := gs.DB.QueryRow(`
+		WITH user_images AS (
+			SELECT images.id, images.blob_hash, images.original_hash
+			FROM images
+			JOIN galleries ON galleries.id=images.gallery_id
+			WHERE galleries.user_id=$1
+		), refs AS (
+			SELECT blob_hash AS hash FROM user_images
+			UNION ALL
+			SELECT original_hash FROM user_images WHERE original_hash IS NOT NULL
+			UNION ALL
+			SELECT image_renditions.blob_hash
+			FROM image_renditions
+			JOIN user_images ON user_images.id=image_renditions.image_id
+		)
+		SELECT
+		(SELECT COUNT(*) FROM user_images),
+		COALESCE((SELECT SUM(blobs.size) FROM refs JOIN blobs ON blobs.hash=refs.hash), 0),
+		COALESCE((SELECT SUM(size) FROM blobs WHERE hash IN (SELECT hash FROM refs)), 0)`, userID)
+
+	err := row.Scan(&report.Images, &report.UploadedBytes, &report.StoredBytes)
+	if err != nil {
+		return nil, fmt.Errorf("storage report: %w", err)
+	}
+
+	return &report, nil
+}
+
+type tempBlob struct {
+	hash string
+	size int64
+	path string
+}
+
+func (gs *GalleryService) writeTempBlob(contents io.Reader) (*tempBlob, error) {
+	blobsDir := gs.blobsDir()
+
+	err := os.MkdirAll(blobsDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("creating blobs directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(blobsDir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary blob: %w", err)
+	}
+	defer tmp.Close()
+
+	h := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, h), contents)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("copying contents to blob: %w", err)
+	}
+
+	blob := tempBlob{
+		hash: hex.EncodeToString(h.Sum(nil)),
+		size: size,
+		path: tmp.Name(),
+	}
+
+	return &blob, nil
+}
+
+// retainBlob moves the blob file into place before the transaction commits.
+// If the transaction is rolled back the file is left without a row and is
+// removed later by SweepBlobs.
+func (gs *GalleryService) retainBlob(tx *sql.Tx, blob *tempBlob) error {
+	_, err := tx.Exec(`
+		INSERT INTO blobs (hash, size, ref_count)
+		VALUES ($1, $2, 1) ON CONFLICT (hash) DO
+		UPDATE
+		SET ref_count=blobs.ref_count+1`, blob.hash, blob.size)
+
+	if err != nil {
+		return fmt.Errorf("retaining blob: %w", err)
+	}
+
+	blobPath := gs.blobPath(blob.hash)
+
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return fmt.Errorf("retaining blob: %w", err)
+	}
+
+	err = os.Rename(blob.path, blobPath)
+	if err != nil {
+		return fmt.Errorf("retaining blob: %w", err)
+	}
+
+	return nil
+}
+
+func retainHashes(tx *sql.Tx, hashes ...string) error {
+	for _, hash := range hashes {
+		_, err := tx.Exec(`
+			UPDATE blobs
+			SET ref_count=ref_count+1
+			WHERE hash=$1`, hash)
+
+		if err != nil {
+			return fmt.Errorf("retaining blob: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// releaseBlobs deletes the rows of blobs that are no longer referenced. Files
+// are never unlinked inside the transaction, SweepBlobs removes them once the
+// deletion is committed.
+func (gs *GalleryService) releaseBlobs(tx *sql.Tx, hashes ...string) error {
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+
+		var refCount int
+
+		row := tx.QueryRow(`
+			UPDATE blobs
+			SET ref_count=ref_count-1
+			WHERE hash=$1
+			RETURNING ref_count`, hash)
+
+		err := row.Scan(&refCount)
+		if err != nil {
+			return fmt.Errorf("releasing blob: %w", err)
+		}
+
+		if refCount > 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM blobs WHERE hash=$1`, hash)
+
+		if err != nil {
+			return fmt.Errorf("releasing blob: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// SweepBlobs removes blob files without a row in the blobs table, along with
+// abandoned temporary uploads. Files modified within the grace period are
+// kept because their transaction may not have committed yet.
+func (gs *GalleryService) SweepBlobs(grace time.Duration) (int, error) {
+	if grace <= 0 {
+		grace = DefaultBlobGracePeriod
+	}
+
+	cutoff := time.Now().Add(-grace)
+
+	entries, err := os.ReadDir(gs.blobsDir())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("sweeping blobs: %w", err)
+	}
+
+	var removed int
+
+	for _, entry := range entries {
+		path := filepath.Join(gs.blobsDir(), entry.Name())
+
+		if !entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), "upload-") && removeStale(path, cutoff) {
+				removed++
+			}
+			continue
+		}
+
+		n, err := gs.sweepBlobDir(path, cutoff)
+		if err != nil {
+			return removed, fmt.Errorf("sweeping blobs: %w", err)
+		}
+
+		removed += n
+	}
+
+	return removed, nil
+}
+
+func (gs *GalleryService) sweepBlobDir(dir string, cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var candidates []string
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		candidates = append(candidates, entry.Name())
+	}
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	rows, err := gs.DB.Query(`
+		SELECT hash FROM blobs WHERE hash = ANY($1)`, candidates)
+
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+
+	for rows.Next() {
+		var hash string
+
+		err = rows.Scan(&hash)
+		if err != nil {
+			return 0, err
+		}
+
+		stored[hash] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+
+	for _, hash := range candidates {
+		if !stored[hash] && removeStale(filepath.Join(dir, hash), cutoff) {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// removeStale removes the file if it still hasn't been modified since cutoff,
+// so a blob that was uploaded again while sweeping is kept.
+func removeStale(path string, cutoff time.Time) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.ModTime().After(cutoff) {
+		return false
+	}
+
+	return os.Remove(path) == nil
+}
+
+func queryHashes(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query hashes: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("query hashes: %w", err)
+	}
+
+	var hashes []string
+
+	for rows.Next() {
+		row := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, fmt.Errorf("query hashes: %w", err)
+		}
+
+		for _, hash := range row {
+			if hash.Valid {
+				hashes = append(hashes, hash.String)
+			}
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query hashes: %w", err)
+	}
+
+	return hashes, nil
+}
+
+func (gs *GalleryService) blobsDir() string {
+	return filepath.Join(gs.imagesDir(), DefaultBlobsDir)
+}
+
+func (gs *GalleryService) blobPath(hash string) string {
+	return filepath.Join(gs.blobsDir(), hash[:2], hash)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepBlobsTemporaryUploads(t *testing.T) {
+	gs := GalleryService{ImagesDir: t.TempDir()}
+
+	err := os.MkdirAll(gs.blobsDir(), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]time.Time{
+		"upload-abandoned": old,
+		"upload-recent":    time.Now(),
+		"unrelated":        old,
+	}
+
+	for name, modTime := range files {
+		path := filepath.Join(gs.blobsDir(), name)
+
+		err = os.WriteFile(path, []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := gs.SweepBlobs(time.Hour)
+	if err != nil {
+		t.Fatalf("SweepBlobs() err = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("SweepBlobs() removed = %d, want 1", removed)
+	}
+
+	for name, want := range map[string]bool{"upload-abandoned": false, "upload-recent": true, "unrelated": true} {
+		_, err := os.Stat(filepath.Join(gs.blobsDir(), name))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSweepBlobsMissingDir(t *testing.T) {
+	gs := GalleryService{ImagesDir: filepath.Join(t.TempDir(), "missing")}
+
+	removed, err := gs.SweepBlobs(time.Hour)
+	if err != nil || removed != 0 {
+		t.Errorf("SweepBlobs() = %d, %v, want 0, nil", removed, err)
+	}
+}
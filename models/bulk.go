@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxTagLength     = 50
+	MaxCaptionLength = 500
+)
+
+func (gs *GalleryService) DeleteImages(galleryID int, filenames []string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := lockImages(tx, galleryID, filenames)
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE images
+		SET deleted_at=NOW()
+		WHERE id=ANY($1)`, imageIDs)
+
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	err = touchGalleries(tx, galleryID)
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) TagImages(galleryID int, filenames []string, tags []string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("tagging images: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := lockImages(tx, galleryID, filenames)
+	if err != nil {
+		return fmt.Errorf("tagging images: %w", err)
+	}
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`
+			INSERT INTO image_tags (image_id, tag)
+			SELECT id, $2 FROM unnest($1::int[]) AS id
+			ON CONFLICT DO NOTHING`, imageIDs, tag)
+
+		if err != nil {
+			return fmt.Errorf("tagging images: %w", err)
+		}
+	}
+
+	err = touchGalleries(tx, galleryID)
+	if err != nil {
+		return fmt.Errorf("tagging images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("tagging images: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) CaptionImages(galleryID int, filenames []string, caption string) error {
+	caption = strings.TrimSpace(caption)
+	if utf8.RuneCountInString(caption) > MaxCaptionLength {
+		return fmt.Errorf("captioning images: %w", ErrCaptionTooLong)
+	}
+
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("captioning images: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := lockImages(tx, galleryID, filenames)
+	if err != nil {
+		return fmt.Errorf("captioning images: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE images
+		SET caption=$2
+		WHERE id=ANY($1)`, imageIDs, caption)
+
+	if err != nil {
+		return fmt.Errorf("captioning images: %w", err)
+	}
+
+	err = touchGalleries(tx, galleryID)
+	if err != nil {
+		return fmt.Errorf("captioning images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("captioning images: %w", err)
+	}
+
+	return nil
+}
+
+func ParseTags(s string) ([]string, error) {
+	var tags []string
+
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Errorf("parsing tags: %w", ErrInvalidTag)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("parsing tags: %w", ErrInvalidTag)
+	}
+
+	return tags, nil
+}
+
+func splitTags(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return nil
+	}
+
+	return strings.Split(tags.String, ",")
+}
+
+func lockImages(tx *sql.Tx, galleryID int, filenames []string) ([]int, error) {
+	var imageIDs []int
+
+	for _, filename := range filenames {
+		imageID, err := lockImage(tx, galleryID, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	return imageIDs, nil
+}
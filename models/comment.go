@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+const (
+	MaxCommentLength         = 2000
+	DefaultCommentRateLimit  = 5
+	DefaultCommentRateWindow = 10 * time.Minute
+)
+
+type CommentMode string
+
+const (
+	CommentsDisabled  CommentMode = "disabled"
+	CommentsOpen      CommentMode = "open"
+	CommentsModerated CommentMode = "moderated"
+)
+
+func CommentModes() []CommentMode {
+	return []CommentMode{CommentsOpen, CommentsModerated, CommentsDisabled}
+}
+
+func ParseCommentMode(s string) (CommentMode, error) {
+	for _, mode := range CommentModes() {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+
+	return CommentsDisabled, fmt.Errorf("parsing comment mode %q: %w", s, ErrInvalidCommentMode)
+}
+
+type Comment struct {
+	ID        int
+	GalleryID int
+	Filename  string
+	UserID    int
+	Handle    string
+	Author    string
+	Body      string
+	Approved  bool
+	CreatedAt time.Time
+}
+
+type CommentService struct {
+	DB         *sql.DB
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+func (cs *CommentService) Create(galleryID int, filename string, userID int, body string, approved bool) (*Comment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > MaxCommentLength {
+		return nil, fmt.Errorf("creating comment: %w", ErrInvalidComment)
+	}
+
+	tx, err := cs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT id FROM users WHERE id=$1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+
+	var recent int
+
+	row := tx.QueryRow(`
+		SELECT COUNT(*) FROM comments
+		WHERE user_id=$1 AND created_at > $2`, userID, time.Now().Add(-cs.Window()))
+
+	err = row.Scan(&recent)
+	if err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+
+	if recent >= cs.rateLimit() {
+		return nil, fmt.Errorf("creating comment: %w", ErrCommentRateLimited)
+	}
+
+	var imageID sql.NullInt64
+
+	if filename != "" {
+		row = tx.QueryRow(`
+			SELECT id FROM images
+			WHERE gallery_id=$1 AND filename=$2 AND NOT pending AND deleted_at IS NULL`, galleryID, filename)
+
+		err = row.Scan(&imageID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("creating comment: %w", ErrNotFound)
+			}
+
+			return nil, fmt.Errorf("creating comment: %w", err)
+		}
+	}
+
+	comment := Comment{
+		GalleryID: galleryID,
+		Filename:  filename,
+		UserID:    userID,
+		Body:      body,
+		Approved:  approved,
+	}
+
+	row = tx.QueryRow(`
+		INSERT INTO comments (gallery_id, image_id, user_id, body, approved)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, galleryID, imageID, userID, body, approved)
+
+	err = row.Scan(&comment.ID, &comment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("creating comment: %w", err)
+	}
+
+	return &comment, nil
+}
+
+func (cs *CommentService) ByGalleryID(galleryID int, includePending bool) ([]Comment, error) {
+	rows, err := cs.DB.Query(`
+		SELECT comments.id, COALESCE(images.filename, ''), comments.user_id, users.handle,
+		COALESCE(NULLIF(users.display_name, ''), '@' || users.handle),
+		comments.body, comments.approved, comments.created_at
+		FROM comments
+		JOIN users ON users.id=comments.user_id
+		LEFT JOIN images ON images.id=comments.image_id
+		WHERE comments.gallery_id=$1 AND (comments.approved OR $2)
+		AND (images.id IS NULL OR images.deleted_at IS NULL)
+		ORDER BY comments.created_at, comments.id`, galleryID, includePending)
+
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+
+	var comments []Comment
+
+	for rows.Next() {
+		comment := Comment{
+			GalleryID: galleryID,
+		}
+
+		err = rows.Scan(&comment.ID, &comment.Filename, &comment.UserID, &comment.Handle, &comment.Author,
+			&comment.Body, &comment.Approved, &comment.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query comments: %w", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+
+	return comments, nil
+}
+
+func (cs *CommentService) ByID(galleryID, id int) (*Comment, error) {
+	comment := Comment{
+		ID:        id,
+		GalleryID: galleryID,
+	}
+
+	row := cs.DB.QueryRow(`
+		SELECT COALESCE(images.filename, ''), comments.user_id, users.handle,
+		COALESCE(NULLIF(users.display_name, ''), '@' || users.handle),
+		comments.body, comments.approved, comments.created_at
+		FROM comments
+		JOIN users ON users.id=comments.user_id
+		LEFT JOIN images ON images.id=comments.image_id
+		WHERE comments.gallery_id=$1 AND comments.id=$2`, galleryID, id)
+
+	err := row.Scan(&comment.Filename, &comment.UserID, &comment.Handle, &comment.Author,
+		&comment.Body, &comment.Approved, &comment.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query comment by id: %w", err)
+	}
+
+	return &comment, nil
+}
+
+func (cs *CommentService) Approve(galleryID, id int) error {
+	result, err := cs.DB.Exec(`
+		UPDATE comments
+		SET approved=TRUE
+		WHERE gallery_id=$1 AND id=$2`, galleryID, id)
+
+	if err != nil {
+		return fmt.Errorf("approving comment: %w", err)
+	}
+
+	return checkAffected(result, "approving comment")
+}
+
+func (cs *CommentService) Delete(galleryID, id int) error {
+	result, err := cs.DB.Exec(`
+		DELETE FROM comments
+		WHERE gallery_id=$1 AND id=$2`, galleryID, id)
+
+	if err != nil {
+		return fmt.Errorf("deleting comment: %w", err)
+	}
+
+	return checkAffected(result, "deleting comment")
+}
+
+func (cs *CommentService) SetMode(galleryID int, mode CommentMode) error {
+	result, err := cs.DB.Exec(`
+		UPDATE galleries
+		SET comments=$2
+		WHERE id=$1 AND deleted_at IS NULL`, galleryID, string(mode))
+
+	if err != nil {
+		return fmt.Errorf("setting comment mode: %w", err)
+	}
+
+	return checkAffected(result, "setting comment mode")
+}
+
+func (cs *CommentService) rateLimit() int {
+	if cs.RateLimit <= 0 {
+		return DefaultCommentRateLimit
+	}
+
+	return cs.RateLimit
+}
+
+func (cs *CommentService) Window() time.Duration {
+	if cs.RateWindow <= 0 {
+		return DefaultCommentRateWindow
+	}
+
+	return cs.RateWindow
+}
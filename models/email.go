@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"html"
 
 	"github.com/go-mail/mail/v2"
 )
@@ -74,6 +75,177 @@ func (es *EmailService) ForgotPassword(to, resetURL string) error {
 	return nil
 }
 
+func (es *EmailService) LoginLink(to, loginURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "Your sign-in link",
+		Plaintext: "Sign in to Galaria by clicking on the link below. It expires in a few minutes and only works in the browser you requested it from.\n" + loginURL,
+		HTML: `
+			<p>Here is the sign-in link you asked for.</p>
+			<p>It expires in a few minutes and only works in the browser you requested it from.</p>
+			<a href="` + loginURL + `">` + loginURL + `</a>
+			<p>If you didn't request this link, you can safely ignore this email.</p>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("login link: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) GalleryInvitation(to, inviter, galleryTitle, acceptURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "You've been invited to a gallery",
+		Plaintext: inviter + " invited you to collaborate on \"" + galleryTitle + "\". Accept the invitation by clicking on the link below.\n" + acceptURL,
+		HTML: `
+			<p>` + html.EscapeString(inviter) + ` invited you to collaborate on <strong>` + html.EscapeString(galleryTitle) + `</strong>.</p>
+			<p>To accept the invitation, simply click on the link below.</p>
+			<a href="` + acceptURL + `">` + acceptURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("gallery invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) OrganizationInvitation(to, inviter, organizationName, acceptURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "You've been invited to join an organization",
+		Plaintext: inviter + " invited you to join \"" + organizationName + "\". Accept the invitation by clicking on the link below.\n" + acceptURL,
+		HTML: `
+			<p>` + html.EscapeString(inviter) + ` invited you to join <strong>` + html.EscapeString(organizationName) + `</strong>.</p>
+			<p>To accept the invitation, simply click on the link below.</p>
+			<a href="` + acceptURL + `">` + acceptURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("organization invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) ProofingSubmitted(to, client, galleryTitle string, images int, reviewURL string) error {
+	count := fmt.Sprintf("%d images", images)
+	if images == 1 {
+		count = "1 image"
+	}
+
+	email := Email{
+		To:        to,
+		Subject:   "A proofing selection was submitted",
+		Plaintext: client + " selected " + count + " in \"" + galleryTitle + "\". Review the selection by clicking on the link below.\n" + reviewURL,
+		HTML: `
+			<p>` + html.EscapeString(client) + ` selected ` + count + ` in <strong>` + html.EscapeString(galleryTitle) + `</strong>.</p>
+			<p>To review the selection and its notes, simply click on the link below.</p>
+			<a href="` + reviewURL + `">` + reviewURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("proofing submitted: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) NewComment(to, author, galleryTitle, body string, pending bool, commentURL string) error {
+	status := ""
+	if pending {
+		status = " It is waiting for your approval."
+	}
+
+	email := Email{
+		To:        to,
+		Subject:   "New comment on " + galleryTitle,
+		Plaintext: author + " commented on \"" + galleryTitle + "\"." + status + "\n\n" + body + "\n\n" + commentURL,
+		HTML: `
+			<p>` + html.EscapeString(author) + ` commented on <strong>` + html.EscapeString(galleryTitle) + `</strong>.` + status + `</p>
+			<blockquote style="white-space: pre-wrap;">` + html.EscapeString(body) + `</blockquote>
+			<a href="` + commentURL + `">` + commentURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("new comment: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) ConfirmEmailChange(to, confirmURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "Confirm your new email address",
+		Plaintext: "Confirm that you want to use this address for your Galaria account by clicking on the link below.\n" + confirmURL,
+		HTML: `
+			<p>You asked to use this address for your Galaria account.</p>
+			<p>To confirm the change, simply click on the link below. If you didn't ask for this, you can ignore this email.</p>
+			<a href="` + confirmURL + `">` + confirmURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("confirm email change: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) EmailChangeRequested(to, newEmail, revertURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "Your email address is being changed",
+		Plaintext: "Someone asked to change the email address of your Galaria account to " + newEmail + ". If this wasn't you, revert the change by clicking on the link below.\n" + revertURL,
+		HTML: `
+			<p>Someone asked to change the email address of your Galaria account to <strong>` + html.EscapeString(newEmail) + `</strong>.</p>
+			<p>If this wasn't you, revert the change and sign out everywhere by clicking on the link below.</p>
+			<a href="` + revertURL + `">` + revertURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("email change requested: %w", err)
+	}
+
+	return nil
+}
+
+func (es *EmailService) PasswordChanged(to, resetURL string) error {
+	email := Email{
+		To:        to,
+		Subject:   "Your password was changed",
+		Plaintext: "The password of your Galaria account was just changed and you were signed out on other devices. If this wasn't you, reset your password by clicking on the link below.\n" + resetURL,
+		HTML: `
+			<p>The password of your Galaria account was just changed and you were signed out on other devices.</p>
+			<p>If this wasn't you, reset your password right away by clicking on the link below.</p>
+			<a href="` + resetURL + `">` + resetURL + `</a>
+		`,
+	}
+
+	err := es.Send(email)
+	if err != nil {
+		return fmt.Errorf("password changed: %w", err)
+	}
+
+	return nil
+}
+
 func (es *EmailService) setFrom(msg *mail.Message, email Email) {
 	var from string
 
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	DefaultEmailChangeDuration = 24 * time.Hour
+	DefaultEmailRevertDuration = 7 * 24 * time.Hour
+)
+
+type EmailChange struct {
+	ID              int
+	UserID          int
+	OldEmail        string
+	NewEmail        string
+	Token           string
+	RevertToken     string
+	ExpiresAt       time.Time
+	RevertExpiresAt time.Time
+	ConfirmedAt     sql.NullTime
+}
+
+type EmailChangeService struct {
+	DB             *sql.DB
+	BytesPerToken  int
+	Duration       time.Duration
+	RevertDuration time.Duration
+}
+
+func (ecs *EmailChangeService) Create(user *User, newEmail string) (*EmailChange, error) {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if newEmail == "" || !strings.Contains(newEmail, "@") || newEmail == user.Email {
+		return nil, fmt.Errorf("creating email change: %w", ErrInvalidEmail)
+	}
+
+	var taken bool
+
+	row := ecs.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM users WHERE email=$1)`, newEmail)
+
+	err := row.Scan(&taken)
+	if err != nil {
+		return nil, fmt.Errorf("creating email change: %w", err)
+	}
+
+	if taken {
+		return nil, ErrEmailTaken
+	}
+
+	token, err := rand.String(ecs.bytesPerToken())
+	if err != nil {
+		return nil, fmt.Errorf("creating email change: %w", err)
+	}
+
+	revertToken, err := rand.String(ecs.bytesPerToken())
+	if err != nil {
+		return nil, fmt.Errorf("creating email change: %w", err)
+	}
+
+	duration := ecs.Duration
+	if duration == 0 {
+		duration = DefaultEmailChangeDuration
+	}
+
+	revertDuration := ecs.RevertDuration
+	if revertDuration == 0 {
+		revertDuration = DefaultEmailRevertDuration
+	}
+
+	change := EmailChange{
+		UserID:          user.ID,
+		OldEmail:        user.Email,
+		NewEmail:        newEmail,
+		Token:           token,
+		RevertToken:     revertToken,
+		ExpiresAt:       time.Now().Add(duration),
+		RevertExpiresAt: time.Now().Add(revertDuration),
+	}
+
+	row = ecs.DB.QueryRow(`
+		INSERT INTO email_changes (user_id, old_email, new_email, token_hash, revert_token_hash, expires_at, revert_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (user_id) WHERE confirmed_at IS NULL DO
+		UPDATE
+		SET old_email=$2, new_email=$3, token_hash=$4, revert_token_hash=$5,
+		expires_at=$6, revert_expires_at=$7
+		RETURNING id`, change.UserID, change.OldEmail, change.NewEmail, ecs.hash(token), ecs.hash(revertToken),
+		change.ExpiresAt, change.RevertExpiresAt)
+
+	err = row.Scan(&change.ID)
+	if err != nil {
+		return nil, fmt.Errorf("creating email change: %w", err)
+	}
+
+	return &change, nil
+}
+
+func (ecs *EmailChangeService) Confirm(token string) (*EmailChange, error) {
+	tx, err := ecs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+	defer tx.Rollback()
+
+	change, err := lockEmailChange(tx, "token_hash", ecs.hash(token))
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	if change.ConfirmedAt.Valid || time.Now().After(change.ExpiresAt) {
+		return nil, fmt.Errorf("confirming email change: %w", ErrNotFound)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET email=$3
+		WHERE id=$1 AND email=$2`, change.UserID, change.OldEmail, change.NewEmail)
+
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			return nil, ErrEmailTaken
+		}
+
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	err = checkAffected(result, "confirming email change")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE email_changes
+		SET confirmed_at=NOW()
+		WHERE id=$1`, change.ID)
+
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	// Links sent to the old address must not outlive the change.
+	_, err = tx.Exec(`
+		DELETE FROM password_resets WHERE user_id=$1`, change.UserID)
+
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM login_links WHERE user_id=$1`, change.UserID)
+
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("confirming email change: %w", err)
+	}
+
+	return change, nil
+}
+
+func (ecs *EmailChangeService) Revert(token string) (*EmailChange, error) {
+	tx, err := ecs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("reverting email change: %w", err)
+	}
+	defer tx.Rollback()
+
+	change, err := lockEmailChange(tx, "revert_token_hash", ecs.hash(token))
+	if err != nil {
+		return nil, fmt.Errorf("reverting email change: %w", err)
+	}
+
+	if time.Now().After(change.RevertExpiresAt) {
+		return nil, fmt.Errorf("reverting email change: %w", ErrNotFound)
+	}
+
+	if change.ConfirmedAt.Valid {
+		// Confirmed changes keep their own rows, so the address can be
+		// restored even after later changes were confirmed on top of it.
+		result, err := tx.Exec(`
+			UPDATE users
+			SET email=$2
+			WHERE id=$1 AND email IN (
+				SELECT new_email
+				FROM email_changes
+				WHERE user_id=$1 AND confirmed_at >= $3)`, change.UserID, change.OldEmail, change.ConfirmedAt.Time)
+
+		if err != nil {
+			var pgError *pgconn.PgError
+			if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+				return nil, ErrEmailTaken
+			}
+
+			return nil, fmt.Errorf("reverting email change: %w", err)
+		}
+
+		err = checkAffected(result, "reverting email change")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM sessions WHERE user_id=$1`, change.UserID)
+
+		if err != nil {
+			return nil, fmt.Errorf("reverting email change: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM email_changes
+		WHERE id=$1 OR (user_id=$2 AND (confirmed_at IS NULL OR confirmed_at >= $3))`,
+		change.ID, change.UserID, change.ConfirmedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("reverting email change: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("reverting email change: %w", err)
+	}
+
+	return change, nil
+}
+
+func lockEmailChange(tx *sql.Tx, column, tokenHash string) (*EmailChange, error) {
+	var change EmailChange
+
+	row := tx.QueryRow(`
+		SELECT id, user_id, old_email, new_email, expires_at, revert_expires_at, confirmed_at
+		FROM email_changes
+		WHERE `+column+`=$1 FOR UPDATE`, tokenHash)
+
+	err := row.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail,
+		&change.ExpiresAt, &change.RevertExpiresAt, &change.ConfirmedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return &change, nil
+}
+
+func (ecs *EmailChangeService) bytesPerToken() int {
+	if ecs.BytesPerToken < MinBytesPerToken {
+		return MinBytesPerToken
+	}
+
+	return ecs.BytesPerToken
+}
+
+func (ecs *EmailChangeService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
@@ -9,8 +9,45 @@ import (
 )
 
 var (
-	ErrEmailTaken = errors.New("models: email address is already in use")
-	ErrNotFound   = errors.New("models: resource could not be found")
+	ErrEmailTaken     = errors.New("models: email address is already in use")
+	ErrNotFound       = errors.New("models: resource could not be found")
+	ErrQuotaExceeded  = errors.New("models: storage quota exceeded")
+	ErrInvalidTag     = errors.New("models: tags must be comma separated and at most 50 characters long")
+	ErrCaptionTooLong = errors.New("models: caption is too long")
+	ErrInvalidRole    = errors.New("models: invalid role")
+	ErrLastAdmin      = errors.New("models: organization must keep at least one admin")
+	ErrOwnGallery     = errors.New("models: users cannot join their own gallery")
+
+	ErrInvalidUploadLink   = errors.New("models: invalid upload link limits")
+	ErrUploadLinkExhausted = errors.New("models: upload link has expired or reached its limit")
+
+	ErrInvalidProofingLimit = errors.New("models: invalid proofing selection limit")
+	ErrProofingLimit        = errors.New("models: proofing selection limit reached")
+	ErrProofNoteTooLong     = errors.New("models: proofing note is too long")
+
+	ErrInvalidRating = errors.New("models: rating must be between 0 and 5 stars")
+	ErrInvalidFlag   = errors.New("models: invalid flag")
+	ErrInvalidLabel  = errors.New("models: invalid colour label")
+
+	ErrInvalidCommentMode = errors.New("models: invalid comment mode")
+	ErrInvalidComment     = errors.New("models: comment is empty or too long")
+	ErrCommentRateLimited = errors.New("models: too many comments, try again later")
+
+	ErrFollowSelf = errors.New("models: users cannot follow themselves")
+
+	ErrInvalidHandle  = errors.New("models: invalid handle")
+	ErrHandleTaken    = errors.New("models: handle is already in use")
+	ErrProfileTooLong = errors.New("models: display name or bio is too long")
+
+	ErrInvalidEmail = errors.New("models: invalid email address")
+	ErrWeakPassword = errors.New("models: password is too weak")
+
+	ErrRateLimited = errors.New("models: too many requests, try again later")
+
+	ErrInvalidIDToken  = errors.New("models: invalid id token")
+	ErrIdentityTaken   = errors.New("models: identity is linked to another account")
+	ErrAlreadyLinked   = errors.New("models: account is already linked to this provider")
+	ErrLastLoginMethod = errors.New("models: account must keep a password or another linked identity")
 )
 
 type FileError struct {
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	DefaultImageEventsChannel = "galaria_images"
+	imageEventsBuffer         = 16
+	maxImageEventsRetry       = time.Minute
+)
+
+type ImageEvent struct {
+	GalleryID int    `json:"gallery_id"`
+	Filename  string `json:"filename"`
+}
+
+type ImageEvents interface {
+	Publish(event ImageEvent) error
+	Subscribe(galleryID int) (<-chan ImageEvent, func())
+}
+
+type LocalImageEvents struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan ImageEvent]struct{}
+}
+
+func NewLocalImageEvents() *LocalImageEvents {
+	return &LocalImageEvents{
+		subscribers: make(map[int]map[chan ImageEvent]struct{}),
+	}
+}
+
+func (le *LocalImageEvents) Publish(event ImageEvent) error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	var dropped int
+
+	for ch := range le.subscribers[event.GalleryID] {
+		select {
+		case ch <- event:
+		default:
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		fmt.Printf("dropped image event %v in gallery %d for %d slow subscribers\n", event.Filename, event.GalleryID, dropped)
+	}
+
+	return nil
+}
+
+func (le *LocalImageEvents) Subscribe(galleryID int) (<-chan ImageEvent, func()) {
+	ch := make(chan ImageEvent, imageEventsBuffer)
+
+	le.mu.Lock()
+	if le.subscribers[galleryID] == nil {
+		le.subscribers[galleryID] = make(map[chan ImageEvent]struct{})
+	}
+	le.subscribers[galleryID][ch] = struct{}{}
+	le.mu.Unlock()
+
+	var once sync.Once
+
+	unsubscribe := func() {
+		once.Do(func() {
+			le.mu.Lock()
+			defer le.mu.Unlock()
+
+			delete(le.subscribers[galleryID], ch)
+			if len(le.subscribers[galleryID]) == 0 {
+				delete(le.subscribers, galleryID)
+			}
+
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+type PostgresImageEvents struct {
+	DB      *sql.DB
+	Channel string
+
+	local *LocalImageEvents
+}
+
+func NewPostgresImageEvents(db *sql.DB, channel string) *PostgresImageEvents {
+	if channel == "" {
+		channel = DefaultImageEventsChannel
+	}
+
+	return &PostgresImageEvents{
+		DB:      db,
+		Channel: channel,
+		local:   NewLocalImageEvents(),
+	}
+}
+
+func (pe *PostgresImageEvents) Publish(event ImageEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("publishing image event: %w", err)
+	}
+
+	_, err = pe.DB.Exec(`SELECT pg_notify($1, $2)`, pe.Channel, string(payload))
+	if err != nil {
+		return fmt.Errorf("publishing image event: %w", err)
+	}
+
+	return nil
+}
+
+func (pe *PostgresImageEvents) Subscribe(galleryID int) (<-chan ImageEvent, func()) {
+	return pe.local.Subscribe(galleryID)
+}
+
+// Listen forwards notifications to local subscribers until ctx is done. When
+// the connection drops it reconnects, doubling the wait after each failure up
+// to a minute.
+func (pe *PostgresImageEvents) Listen(ctx context.Context, retry time.Duration) {
+	wait := retry
+
+	for {
+		started := time.Now()
+
+		err := pe.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > maxImageEventsRetry {
+			wait = retry
+		}
+
+		fmt.Printf("listening for image events: %v, retrying in %v\n", err, wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		wait = min(wait*2, maxImageEventsRetry)
+	}
+}
+
+func (pe *PostgresImageEvents) listen(ctx context.Context) error {
+	conn, err := pe.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+
+		_, err := pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{pe.Channel}.Sanitize())
+		if err != nil {
+			return err
+		}
+		defer pgxConn.Exec(context.Background(), "UNLISTEN *")
+
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			var event ImageEvent
+
+			err = json.Unmarshal([]byte(notification.Payload), &event)
+			if err != nil {
+				fmt.Printf("skipping image event %q: %v\n", notification.Payload, err)
+				continue
+			}
+
+			pe.local.Publish(event)
+		}
+	})
+}
+
+func (gs *GalleryService) publishImages(galleryID int, filenames ...string) {
+	if gs.Events == nil {
+		return
+	}
+
+	for _, filename := range filenames {
+		err := gs.Events.Publish(ImageEvent{
+			GalleryID: galleryID,
+			Filename:  filename,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
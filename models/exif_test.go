@@ -0,0 +1,136 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// withOrientation inserts an EXIF segment holding only an orientation tag
+// right after the start of image marker.
+func withOrientation(t *testing.T, jpg []byte, order binary.ByteOrder, orientation uint16) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	binary.Write(&tiff, order, uint16(1))
+	binary.Write(&tiff, order, uint16(exifOrientationTag))
+	binary.Write(&tiff, order, uint16(3))
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, orientation)
+	binary.Write(&tiff, order, uint16(0))
+	binary.Write(&tiff, order, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(jpg[2:])
+
+	return out.Bytes()
+}
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	err := jpeg.Encode(&buf, testImage(width, height), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := testJPEG(t, 8, 4)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", jpg, 1},
+		{"little endian", withOrientation(t, jpg, binary.LittleEndian, 6), 6},
+		{"big endian", withOrientation(t, jpg, binary.BigEndian, 8), 8},
+		{"out of range", withOrientation(t, jpg, binary.BigEndian, 9), 1},
+		{"not a jpeg", []byte("GIF89a"), 1},
+		{"truncated", withOrientation(t, jpg, binary.BigEndian, 3)[:20], 1},
+		{"empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(bytes.NewReader(tt.data)); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image whose top left pixel is red and every other pixel black.
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+	src.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+	tests := []struct {
+		orientation int
+		width       int
+		height      int
+		redX, redY  int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tt := range tests {
+		got := applyOrientation(src, tt.orientation)
+
+		bounds := got.Bounds()
+		if bounds.Dx() != tt.width || bounds.Dy() != tt.height {
+			t.Errorf("orientation %d: size = %dx%d, want %dx%d", tt.orientation, bounds.Dx(), bounds.Dy(), tt.width, tt.height)
+			continue
+		}
+
+		r, _, _, _ := got.At(tt.redX, tt.redY).RGBA()
+		if r == 0 {
+			t.Errorf("orientation %d: pixel (%d, %d) is not red", tt.orientation, tt.redX, tt.redY)
+		}
+	}
+}
+
+func TestDecodeImageAppliesOrientation(t *testing.T) {
+	var gs GalleryService
+
+	decoded, err := gs.decodeImage(bytes.NewReader(withOrientation(t, testJPEG(t, 8, 4), binary.BigEndian, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds := decoded.img.Bounds()
+	if bounds.Dx() != 4 || bounds.Dy() != 8 {
+		t.Errorf("decoded size = %dx%d, want 4x8", bounds.Dx(), bounds.Dy())
+	}
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+type FavoriteService struct {
+	DB *sql.DB
+}
+
+func (favs *FavoriteService) FavoriteGallery(userID, galleryID int) error {
+	_, err := favs.DB.Exec(`
+		INSERT INTO gallery_favorites (user_id, gallery_id)
+		VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, galleryID)
+
+	if err != nil {
+		return fmt.Errorf("favoriting gallery: %w", err)
+	}
+
+	return nil
+}
+
+func (favs *FavoriteService) UnfavoriteGallery(userID, galleryID int) error {
+	_, err := favs.DB.Exec(`
+		DELETE FROM gallery_favorites
+		WHERE user_id=$1 AND gallery_id=$2`, userID, galleryID)
+
+	if err != nil {
+		return fmt.Errorf("unfavoriting gallery: %w", err)
+	}
+
+	return nil
+}
+
+func (favs *FavoriteService) FavoriteImage(userID, galleryID int, filename string) error {
+	var imageID int
+
+	row := favs.DB.QueryRow(`
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=$2 AND NOT pending AND deleted_at IS NULL`, galleryID, filename)
+
+	err := row.Scan(&imageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("favoriting image: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("favoriting image: %w", err)
+	}
+
+	_, err = favs.DB.Exec(`
+		INSERT INTO image_favorites (user_id, image_id)
+		VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, imageID)
+
+	if err != nil {
+		return fmt.Errorf("favoriting image: %w", err)
+	}
+
+	return nil
+}
+
+func (favs *FavoriteService) UnfavoriteImage(userID, galleryID int, filename string) error {
+	_, err := favs.DB.Exec(`
+		DELETE FROM image_favorites
+		USING images
+		WHERE images.id=image_favorites.image_id
+		AND image_favorites.user_id=$1 AND images.gallery_id=$2 AND images.filename=$3`, userID, galleryID, filename)
+
+	if err != nil {
+		return fmt.Errorf("unfavoriting image: %w", err)
+	}
+
+	return nil
+}
+
+func (favs *FavoriteService) IsGalleryFavorite(userID, galleryID int) (bool, error) {
+	var exists bool
+
+	row := favs.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM gallery_favorites
+			WHERE user_id=$1 AND gallery_id=$2
+		)`, userID, galleryID)
+
+	err := row.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query gallery favorite: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (favs *FavoriteService) FavoriteFilenames(userID, galleryID int) (map[string]bool, error) {
+	rows, err := favs.DB.Query(`
+		SELECT images.filename FROM image_favorites
+		JOIN images ON images.id=image_favorites.image_id
+		WHERE image_favorites.user_id=$1 AND images.gallery_id=$2`, userID, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query image favorites: %w", err)
+	}
+
+	filenames := make(map[string]bool)
+
+	for rows.Next() {
+		var filename string
+
+		err = rows.Scan(&filename)
+		if err != nil {
+			return nil, fmt.Errorf("query image favorites: %w", err)
+		}
+
+		filenames[filename] = true
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query image favorites: %w", err)
+	}
+
+	return filenames, nil
+}
+
+func (favs *FavoriteService) Galleries(userID int) ([]Gallery, error) {
+	rows, err := favs.DB.Query(`
+		SELECT galleries.id, galleries.title, galleries.created_at, galleries.updated_at,
+		(SELECT COUNT(*) FROM gallery_favorites AS likes WHERE likes.gallery_id=galleries.id)
+		FROM gallery_favorites
+		JOIN galleries ON galleries.id=gallery_favorites.gallery_id
+		WHERE gallery_favorites.user_id=$1 AND galleries.deleted_at IS NULL
+		ORDER BY gallery_favorites.created_at DESC`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query favorite galleries: %w", err)
+	}
+
+	var galleries []Gallery
+
+	for rows.Next() {
+		var gallery Gallery
+
+		err = rows.Scan(&gallery.ID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.Likes)
+		if err != nil {
+			return nil, fmt.Errorf("query favorite galleries: %w", err)
+		}
+
+		galleries = append(galleries, gallery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query favorite galleries: %w", err)
+	}
+
+	return galleries, nil
+}
+
+func (favs *FavoriteService) Images(userID int) ([]Image, error) {
+	rows, err := favs.DB.Query(`
+		SELECT images.id, images.gallery_id, images.filename, images.caption,
+		(SELECT COUNT(*) FROM image_favorites AS likes WHERE likes.image_id=images.id),
+		images.created_at
+		FROM image_favorites
+		JOIN images ON images.id=image_favorites.image_id
+		JOIN galleries ON galleries.id=images.gallery_id
+		WHERE image_favorites.user_id=$1
+		AND NOT images.pending AND images.deleted_at IS NULL AND galleries.deleted_at IS NULL
+		ORDER BY image_favorites.created_at DESC`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query favorite images: %w", err)
+	}
+
+	var images []Image
+
+	for rows.Next() {
+		var image Image
+
+		err = rows.Scan(&image.ID, &image.GalleryID, &image.Filename, &image.Caption, &image.Likes, &image.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query favorite images: %w", err)
+		}
+
+		images = append(images, image)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query favorite images: %w", err)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FeedPageSize = 20
+	FeedPreviews = 4
+)
+
+type FeedKind string
+
+const (
+	FeedGallery FeedKind = "gallery"
+	FeedImages  FeedKind = "images"
+)
+
+type FeedItem struct {
+	Kind         FeedKind
+	GalleryID    int
+	GalleryTitle string
+	Handle       string
+	Author       string
+	Images       int
+	Filenames    []string
+	At           time.Time
+}
+
+type FollowService struct {
+	DB *sql.DB
+}
+
+func (fs *FollowService) Follow(followerID, followeeID int) error {
+	if followerID == followeeID {
+		return fmt.Errorf("following user: %w", ErrFollowSelf)
+	}
+
+	_, err := fs.DB.Exec(`
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2) ON CONFLICT DO NOTHING`, followerID, followeeID)
+
+	if err != nil {
+		return fmt.Errorf("following user: %w", err)
+	}
+
+	return nil
+}
+
+func (fs *FollowService) Unfollow(followerID, followeeID int) error {
+	_, err := fs.DB.Exec(`
+		DELETE FROM follows
+		WHERE follower_id=$1 AND followee_id=$2`, followerID, followeeID)
+
+	if err != nil {
+		return fmt.Errorf("unfollowing user: %w", err)
+	}
+
+	return nil
+}
+
+func (fs *FollowService) IsFollowing(followerID, followeeID int) (bool, error) {
+	var exists bool
+
+	row := fs.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM follows
+			WHERE follower_id=$1 AND followee_id=$2
+		)`, followerID, followeeID)
+
+	err := row.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query follow: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (fs *FollowService) Counts(userID int) (followers, following int, err error) {
+	row := fs.DB.QueryRow(`
+		SELECT
+		(SELECT COUNT(*) FROM follows WHERE followee_id=$1),
+		(SELECT COUNT(*) FROM follows WHERE follower_id=$1)`, userID)
+
+	err = row.Scan(&followers, &following)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query follow counts: %w", err)
+	}
+
+	return followers, following, nil
+}
+
+func (fs *FollowService) Feed(userID, page int) ([]FeedItem, bool, error) {
+	page = max(page, 1)
+
+	rows, err := fs.DB.Query(`
+		SELECT kind, gallery_id, title, handle, author, images, filenames, at FROM (
+			SELECT 'gallery' AS kind, galleries.id AS gallery_id, galleries.title, users.handle,
+			COALESCE(NULLIF(users.display_name, ''), '@' || users.handle) AS author, 0 AS images, '' AS filenames, galleries.created_at AS at
+			FROM follows
+			JOIN users ON users.id=follows.followee_id
+			JOIN galleries ON galleries.user_id=follows.followee_id
+			WHERE follows.follower_id=$1
+			AND galleries.organization_id IS NULL AND galleries.deleted_at IS NULL
+
+			UNION ALL
+
+			SELECT 'images', galleries.id, galleries.title, users.handle,
+			COALESCE(NULLIF(users.display_name, ''), '@' || users.handle), COUNT(*), array_to_string((array_agg(images.filename ORDER BY images.created_at DESC))[1:$2], '/'),
+			MAX(images.created_at)
+			FROM follows
+			JOIN users ON users.id=follows.followee_id
+			JOIN galleries ON galleries.user_id=follows.followee_id
+			JOIN images ON images.gallery_id=galleries.id
+			WHERE follows.follower_id=$1
+			AND galleries.organization_id IS NULL AND galleries.deleted_at IS NULL
+			AND NOT images.pending AND images.deleted_at IS NULL
+			GROUP BY galleries.id, galleries.title, users.handle, users.display_name, date_trunc('day', images.created_at)
+		) AS feed
+		ORDER BY at DESC, gallery_id DESC
+		LIMIT $3 OFFSET $4`, userID, FeedPreviews, FeedPageSize+1, (page-1)*FeedPageSize)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("query feed: %w", err)
+	}
+
+	var items []FeedItem
+
+	for rows.Next() {
+		var item FeedItem
+		var filenames string
+
+		err = rows.Scan(&item.Kind, &item.GalleryID, &item.GalleryTitle, &item.Handle,
+			&item.Author, &item.Images, &filenames, &item.At)
+		if err != nil {
+			return nil, false, fmt.Errorf("query feed: %w", err)
+		}
+
+		if filenames != "" {
+			item.Filenames = strings.Split(filenames, "/")
+		}
+
+		items = append(items, item)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, false, fmt.Errorf("query feed: %w", err)
+	}
+
+	if len(items) > FeedPageSize {
+		return items[:FeedPageSize], true, nil
+	}
+
+	return items, false, nil
+}
@@ -3,10 +3,7 @@ package models
 import (
 	"database/sql"
 	"io"
-	"io/fs"
 	"slices"
-	"sort"
-	"syscall"
 	"time"
 
 	"fmt"
@@ -22,35 +19,64 @@ const (
 )
 
 type Image struct {
-	GalleryID int
-	Path      string
-	Filename  string
-	CreatedAt time.Time
+	ID           int
+	GalleryID    int
+	Path         string
+	OriginalPath string
+	Filename     string
+	Caption      string
+	Tags         []string
+	Pending      bool
+	UploadedBy   string
+	Rating       int
+	Flag         Flag
+	Label        Label
+	Likes        int
+	Hash         string
+	Size         int64
+	CreatedAt    time.Time
+	DeletedAt    time.Time
+	Renditions   []Rendition
 }
 
 type Gallery struct {
-	ID        int
-	UserID    int
-	Title     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID             int
+	UserID         int
+	OrganizationID int
+	Title          string
+	Proofing       bool
+	ProofingLimit  int
+	Comments       CommentMode
+	Likes          int
+	OwnerHandle    string
+	OwnerName      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      time.Time
 }
 
 type GalleryService struct {
-	DB        *sql.DB
-	ImagesDir string
+	DB             *sql.DB
+	ImagesDir      string
+	ReEncode       bool
+	MaxPixels      int
+	Renditions     []string
+	DefaultQuota   Quota
+	TrashRetention time.Duration
+	Events         ImageEvents
 }
 
-func (gs *GalleryService) Create(userID int, title string) (*Gallery, error) {
+func (gs *GalleryService) Create(userID, organizationID int, title string) (*Gallery, error) {
 	gallery := Gallery{
-		UserID: userID,
-		Title:  title,
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Title:          title,
 	}
 
 	row := gs.DB.QueryRow(`
-		INSERT INTO galleries (user_id, title)
-		VALUES ($1, $2)
-		RETURNING id, created_at`, gallery.UserID, gallery.Title)
+		INSERT INTO galleries (user_id, organization_id, title)
+		VALUES ($1, NULLIF($2, 0), $3)
+		RETURNING id, created_at`, gallery.UserID, gallery.OrganizationID, gallery.Title)
 
 	err := row.Scan(&gallery.ID, &gallery.CreatedAt)
 	if err != nil {
@@ -60,9 +86,20 @@ func (gs *GalleryService) Create(userID int, title string) (*Gallery, error) {
 	return &gallery, nil
 }
 
-func (gs *GalleryService) Latest() ([]Gallery, error) {
+func (gs *GalleryService) Latest(sort string) ([]Gallery, error) {
+	orderBy := "galleries.created_at DESC"
+	if sort == "likes" {
+		orderBy = "likes DESC, galleries.created_at DESC"
+	}
+
 	rows, err := gs.DB.Query(`
-		SELECT id, title, created_at, updated_at FROM galleries ORDER BY created_at DESC LIMIT 10`)
+		SELECT galleries.id, galleries.title, galleries.created_at, galleries.updated_at,
+		(SELECT COUNT(*) FROM gallery_favorites WHERE gallery_id=galleries.id) AS likes,
+		users.handle, COALESCE(NULLIF(users.display_name, ''), '@' || users.handle)
+		FROM galleries
+		JOIN users ON users.id=galleries.user_id
+		WHERE galleries.deleted_at IS NULL
+		ORDER BY ` + orderBy + ` LIMIT 10`)
 
 	if err != nil {
 		return nil, fmt.Errorf("retrieving all galleries: %w", err)
@@ -73,7 +110,8 @@ func (gs *GalleryService) Latest() ([]Gallery, error) {
 	for rows.Next() {
 		var gallery Gallery
 
-		err = rows.Scan(&gallery.ID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt)
+		err = rows.Scan(&gallery.ID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.Likes,
+			&gallery.OwnerHandle, &gallery.OwnerName)
 		if err != nil {
 			return nil, fmt.Errorf("retrieving all galleries: %w", err)
 		}
@@ -94,10 +132,20 @@ func (gs *GalleryService) ByID(id int) (*Gallery, error) {
 		ID: id,
 	}
 
-	row := gs.DB.QueryRow(`
-		SELECT user_id, title, created_at, updated_at FROM galleries WHERE id=$1`, gallery.ID)
+	var organizationID sql.NullInt64
 
-	err := row.Scan(&gallery.UserID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt)
+	row := gs.DB.QueryRow(`
+		SELECT galleries.user_id, galleries.organization_id, galleries.title, galleries.proofing,
+		galleries.proofing_limit, galleries.comments, galleries.created_at, galleries.updated_at,
+		(SELECT COUNT(*) FROM gallery_favorites WHERE gallery_id=galleries.id),
+		users.handle, COALESCE(NULLIF(users.display_name, ''), '@' || users.handle)
+		FROM galleries
+		JOIN users ON users.id=galleries.user_id
+		WHERE galleries.id=$1 AND galleries.deleted_at IS NULL`, gallery.ID)
+
+	err := row.Scan(&gallery.UserID, &organizationID, &gallery.Title, &gallery.Proofing,
+		&gallery.ProofingLimit, &gallery.Comments, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.Likes,
+		&gallery.OwnerHandle, &gallery.OwnerName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
@@ -106,10 +154,30 @@ func (gs *GalleryService) ByID(id int) (*Gallery, error) {
 		return nil, fmt.Errorf("query gallery by id: %w", err)
 	}
 
+	gallery.OrganizationID = int(organizationID.Int64)
+
 	return &gallery, nil
 }
 
 func (gs *GalleryService) ByUserID(userID int, sort, order string) ([]Gallery, error) {
+	galleries, err := gs.queryGalleries("user_id=$1 AND organization_id IS NULL", userID, sort, order)
+	if err != nil {
+		return nil, fmt.Errorf("query galleries by user: %w", err)
+	}
+
+	return galleries, nil
+}
+
+func (gs *GalleryService) ByOrganizationID(organizationID int, sort, order string) ([]Gallery, error) {
+	galleries, err := gs.queryGalleries("organization_id=$1", organizationID, sort, order)
+	if err != nil {
+		return nil, fmt.Errorf("query galleries by organization: %w", err)
+	}
+
+	return galleries, nil
+}
+
+func (gs *GalleryService) queryGalleries(condition string, id int, sort, order string) ([]Gallery, error) {
 	sort = strings.ToLower(sort)
 	order = strings.ToUpper(order)
 
@@ -121,31 +189,31 @@ func (gs *GalleryService) ByUserID(userID int, sort, order string) ([]Gallery, e
 		order = "DESC"
 	}
 
-	query := fmt.Sprintf("SELECT id, title, created_at FROM galleries WHERE user_id=$1 ORDER BY %s %s", sort, order)
-	rows, err := gs.DB.Query(query, userID)
+	query := fmt.Sprintf("SELECT id, user_id, organization_id, title, created_at FROM galleries WHERE %s AND deleted_at IS NULL ORDER BY %s %s", condition, sort, order)
+	rows, err := gs.DB.Query(query, id)
 
 	if err != nil {
-		return nil, fmt.Errorf("query galleries by user: %w", err)
+		return nil, err
 	}
 
 	var galleries []Gallery
 
 	for rows.Next() {
-		gallery := Gallery{
-			UserID: userID,
-		}
+		var gallery Gallery
+		var organizationID sql.NullInt64
 
-		err := rows.Scan(&gallery.ID, &gallery.Title, &gallery.CreatedAt)
+		err := rows.Scan(&gallery.ID, &gallery.UserID, &organizationID, &gallery.Title, &gallery.CreatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("query galleries by user: %w", err)
+			return nil, err
 		}
 
+		gallery.OrganizationID = int(organizationID.Int64)
 		galleries = append(galleries, gallery)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		return nil, fmt.Errorf("query galleries by user: %w", err)
+		return nil, err
 	}
 
 	return galleries, nil
@@ -164,105 +232,186 @@ func (gs *GalleryService) Update(gallery *Gallery) error {
 	return nil
 }
 
-func (gs *GalleryService) Delete(id int) error {
+func (gs *GalleryService) Transfer(id, userID, organizationID int) error {
 	_, err := gs.DB.Exec(`
-		DELETE FROM galleries WHERE id=$1`, id)
+		UPDATE galleries
+		SET organization_id=NULLIF($3, 0),
+		user_id=CASE WHEN $3=0 THEN $2 ELSE user_id END,
+		updated_at=NOW()
+		WHERE id=$1`, id, userID, organizationID)
 
 	if err != nil {
-		return fmt.Errorf("deleting gallery: %w", err)
+		return fmt.Errorf("transferring gallery: %w", err)
 	}
 
-	err = os.RemoveAll(gs.galleryDir(id))
+	return nil
+}
+
+func (gs *GalleryService) Delete(id int) error {
+	_, err := gs.DB.Exec(`
+		UPDATE galleries
+		SET deleted_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL`, id)
+
 	if err != nil {
-		return fmt.Errorf("deleting gallery images: %w", err)
+		return fmt.Errorf("deleting gallery: %w", err)
 	}
 
 	return nil
 }
 
+// DeleteByUserID purges the user's galleries. Galleries of organizations the
+// user belongs to are handed over to another member first, in the same
+// transaction.
 func (gs *GalleryService) DeleteByUserID(id int) error {
-	rows, err := gs.DB.Query(`
-		DELETE FROM galleries WHERE user_id=$1 RETURNING id`, id)
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("deleting galleries by user: %w", err)
+	}
+	defer tx.Rollback()
 
+	err = leaveOrganizations(tx, id)
 	if err != nil {
 		return fmt.Errorf("deleting galleries by user: %w", err)
 	}
 
-	for rows.Next() {
-		var id int
-		rows.Scan(&id)
+	galleryIDs, err := queryIDs(tx, `
+		SELECT id FROM galleries WHERE user_id=$1 FOR UPDATE`, id)
 
-		err = os.RemoveAll(gs.galleryDir(id))
+	if err != nil {
+		return fmt.Errorf("deleting galleries by user: %w", err)
+	}
+
+	for _, galleryID := range galleryIDs {
+		err = gs.purgeGallery(tx, galleryID)
 		if err != nil {
-			return fmt.Errorf("deleting galleries by user:%w", err)
+			return fmt.Errorf("deleting galleries by user: %w", err)
 		}
 	}
 
-	err = rows.Err()
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("deleting galleries by user:%w", err)
+		return fmt.Errorf("deleting galleries by user: %w", err)
 	}
 
 	return nil
 }
 
-func (gs *GalleryService) Images(galleryID int) ([]Image, error) {
-	globPattern := filepath.Join(gs.galleryDir(galleryID), "*")
+func (gs *GalleryService) Images(galleryID int, filter ImageFilter) ([]Image, error) {
+	where, args := filter.where([]any{galleryID})
+
+	rows, err := gs.DB.Query(`
+		SELECT images.id, images.filename, images.caption,
+		(SELECT string_agg(tag, ',' ORDER BY tag) FROM image_tags WHERE image_id=images.id),
+		images.rating, images.flag, images.label,
+		(SELECT COUNT(*) FROM image_favorites WHERE image_id=images.id) AS likes,
+		images.blob_hash, images.original_hash, blobs.size, images.created_at
+		FROM images
+		JOIN blobs ON blobs.hash=images.blob_hash
+		WHERE images.gallery_id=$1 AND NOT images.pending AND images.deleted_at IS NULL`+where+`
+		ORDER BY `+filter.orderBy(), args...)
 
-	files, err := filepath.Glob(globPattern)
 	if err != nil {
 		return nil, fmt.Errorf("getting images: %w", err)
 	}
 
 	var images []Image
-	for _, file := range files {
-		if hasExtension(file, gs.extensions()) {
-			fileInfo, err := os.Stat(file)
-			if err != nil {
-				return nil, fmt.Errorf("getting images info: %w", err)
-			}
 
-			stat, ok := fileInfo.Sys().(*syscall.Stat_t)
-			if !ok {
-				return nil, fmt.Errorf("getting image info: %w", err)
-			}
+	for rows.Next() {
+		image := Image{
+			GalleryID: galleryID,
+		}
 
-			images = append(images, Image{
-				GalleryID: galleryID,
-				Path:      file,
-				Filename:  filepath.Base(file),
-				CreatedAt: time.Unix(stat.Ctim.Sec, stat.Ctim.Nsec),
-			})
+		var tags, originalHash sql.NullString
+
+		err = rows.Scan(&image.ID, &image.Filename, &image.Caption, &tags,
+			&image.Rating, &image.Flag, &image.Label, &image.Likes,
+			&image.Hash, &originalHash, &image.Size, &image.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("getting images: %w", err)
 		}
+
+		image.Tags = splitTags(tags)
+		gs.setImagePaths(&image, originalHash)
+		images = append(images, image)
 	}
 
-	sort.SliceStable(images, func(i, j int) bool {
-		return images[i].CreatedAt.After(images[j].CreatedAt)
-	})
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("getting images: %w", err)
+	}
 
 	return images, nil
 }
 
 func (gs *GalleryService) Image(galleryID int, filename string) (Image, error) {
-	imagePath := filepath.Join(gs.galleryDir(galleryID), filename)
+	image := Image{
+		GalleryID: galleryID,
+		Filename:  filename,
+	}
 
-	_, err := os.Stat(imagePath)
+	row := gs.DB.QueryRow(`
+		SELECT images.id, images.caption,
+		(SELECT string_agg(tag, ',' ORDER BY tag) FROM image_tags WHERE image_id=images.id),
+		images.pending, images.uploaded_by,
+		images.blob_hash, images.original_hash, blobs.size, images.created_at
+		FROM images
+		JOIN galleries ON galleries.id=images.gallery_id
+		JOIN blobs ON blobs.hash=images.blob_hash
+		WHERE images.gallery_id=$1 AND images.filename=$2
+		AND images.deleted_at IS NULL AND galleries.deleted_at IS NULL`, galleryID, filename)
+
+	var tags, originalHash sql.NullString
+
+	err := row.Scan(&image.ID, &image.Caption, &tags, &image.Pending, &image.UploadedBy,
+		&image.Hash, &originalHash, &image.Size, &image.CreatedAt)
 	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
+		if errors.Is(err, sql.ErrNoRows) {
 			return Image{}, ErrNotFound
 		}
 
 		return Image{}, fmt.Errorf("getting image: %w", err)
 	}
 
-	return Image{
-		GalleryID: galleryID,
-		Path:      imagePath,
-		Filename:  filename,
-	}, nil
+	image.Tags = splitTags(tags)
+	gs.setImagePaths(&image, originalHash)
+
+	rows, err := gs.DB.Query(`
+		SELECT image_renditions.content_type, image_renditions.blob_hash, blobs.size
+		FROM image_renditions
+		JOIN blobs ON blobs.hash=image_renditions.blob_hash
+		WHERE image_renditions.image_id=$1`, image.ID)
+
+	if err != nil {
+		return Image{}, fmt.Errorf("getting image renditions: %w", err)
+	}
+
+	for rows.Next() {
+		var rendition Rendition
+		var hash string
+
+		err = rows.Scan(&rendition.ContentType, &hash, &rendition.Size)
+		if err != nil {
+			return Image{}, fmt.Errorf("getting image renditions: %w", err)
+		}
+
+		rendition.Path = gs.blobPath(hash)
+		image.Renditions = append(image.Renditions, rendition)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return Image{}, fmt.Errorf("getting image renditions: %w", err)
+	}
+
+	return image, nil
 }
 
 func (gs *GalleryService) CreateImage(galleryID int, filename string, contents io.ReadSeeker) error {
+	return gs.createImage(galleryID, filename, contents, nil)
+}
+
+func (gs *GalleryService) createImage(galleryID int, filename string, contents io.ReadSeeker, guest *guestUpload) error {
 	err := checkContentType(contents, gs.imageContentTypes())
 	if err != nil {
 		return fmt.Errorf("creating image %v: %w", filename, err)
@@ -273,58 +422,267 @@ func (gs *GalleryService) CreateImage(galleryID int, filename string, contents i
 		return fmt.Errorf("creating image %v: %w", filename, err)
 	}
 
-	galleryDir := gs.galleryDir(galleryID)
+	decoded, err := gs.decodeImage(contents)
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
 
-	err = os.MkdirAll(galleryDir, 0755)
+	size, err := contents.Seek(0, io.SeekEnd)
 	if err != nil {
-		return fmt.Errorf("creating gallery-%d images directory: %w", galleryID, err)
+		return fmt.Errorf("creating image %v: %w", filename, err)
 	}
 
-	imagePath := filepath.Join(galleryDir, filename)
+	_, err = contents.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	if guest != nil && size > guest.maxBytes {
+		return fmt.Errorf("creating image %v: %w", filename, FileError{
+			Issue: fmt.Sprintf("file is larger than the limit of %d bytes", guest.maxBytes),
+		})
+	}
+
+	// Encoding is slow, so it happens before the owner's row is locked for
+	// the quota check.
+	var served io.Reader = contents
+	if gs.ReEncode {
+		served, err = decoded.encode()
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+	}
 
-	dst, err := os.Create(imagePath)
+	blob, err := gs.writeTempBlob(served)
 	if err != nil {
-		return fmt.Errorf("creating image file: %w", err)
+		return fmt.Errorf("creating image %v: %w", filename, err)
 	}
-	defer dst.Close()
+	defer os.Remove(blob.path)
 
-	_, err = io.Copy(dst, contents)
+	var original *tempBlob
+	if gs.ReEncode {
+		original, err = gs.writeTempBlob(contents)
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+		defer os.Remove(original.path)
+	}
+
+	renditions, err := gs.writeTempRenditions(decoded, blob.size)
+	for _, rendition := range renditions {
+		defer os.Remove(rendition.blob.path)
+	}
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	var uploadedBy string
+
+	if guest != nil {
+		galleryID, err = claimUpload(tx, guest.linkID)
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+
+		filename, err = availableFilename(tx, galleryID, filename)
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+
+		pending = true
+		uploadedBy = guest.uploader
+	}
+
+	err = gs.checkQuota(tx, galleryID, filename, size)
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	err = gs.retainBlob(tx, blob)
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	var originalHash sql.NullString
+	if original != nil {
+		err = gs.retainBlob(tx, original)
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+
+		originalHash = sql.NullString{String: original.hash, Valid: true}
+	}
+
+	var oldHash, oldOriginalHash sql.NullString
+
+	row := tx.QueryRow(`
+		SELECT blob_hash, original_hash FROM images
+		WHERE gallery_id=$1 AND filename=$2
+		FOR UPDATE`, galleryID, filename)
+
+	err = row.Scan(&oldHash, &oldOriginalHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	var imageID int
+
+	row = tx.QueryRow(`
+		INSERT INTO images (gallery_id, filename, blob_hash, original_hash, pending, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (gallery_id, filename) DO
+		UPDATE
+		SET blob_hash=$3, original_hash=$4, pending=$5, uploaded_by=$6, created_at=NOW(), deleted_at=NULL
+		RETURNING id`, galleryID, filename, blob.hash, originalHash, pending, uploadedBy)
+
+	err = row.Scan(&imageID)
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	oldHashes, err := queryHashes(tx, `
+		DELETE FROM image_renditions WHERE image_id=$1 RETURNING blob_hash`, imageID)
+
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	for _, rendition := range renditions {
+		err = gs.retainBlob(tx, rendition.blob)
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO image_renditions (image_id, content_type, blob_hash)
+			VALUES ($1, $2, $3)`, imageID, rendition.contentType, rendition.blob.hash)
+
+		if err != nil {
+			return fmt.Errorf("creating image %v: %w", filename, err)
+		}
+	}
+
+	oldHashes = append(oldHashes, oldHash.String, oldOriginalHash.String)
+
+	err = gs.releaseBlobs(tx, oldHashes...)
 	if err != nil {
-		return fmt.Errorf("copying contents to file: %w", err)
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("creating image %v: %w", filename, err)
+	}
+
+	if !pending {
+		gs.publishImages(galleryID, filename)
 	}
 
 	return nil
 }
 
 func (gs *GalleryService) DeleteImage(galleryID int, filename string) error {
-	image, err := gs.Image(galleryID, filename)
+	result, err := gs.DB.Exec(`
+		UPDATE images
+		SET deleted_at=NOW()
+		WHERE gallery_id=$1 AND filename=$2 AND deleted_at IS NULL`, galleryID, filename)
+
 	if err != nil {
 		return fmt.Errorf("deleting image: %w", err)
 	}
 
-	err = os.Remove(image.Path)
+	return checkAffected(result, "deleting image")
+}
+
+func (gs *GalleryService) ImportLegacyImages() error {
+	dirs, err := filepath.Glob(filepath.Join(gs.imagesDir(), "gallery-*"))
 	if err != nil {
-		return fmt.Errorf("deleting image: %w", err)
+		return fmt.Errorf("importing legacy images: %w", err)
+	}
+
+	for _, dir := range dirs {
+		var galleryID int
+
+		_, err = fmt.Sscanf(filepath.Base(dir), "gallery-%d", &galleryID)
+		if err != nil {
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			return fmt.Errorf("importing legacy images: %w", err)
+		}
+
+		for _, file := range files {
+			if !hasExtension(file, gs.extensions()) {
+				continue
+			}
+
+			err = gs.importLegacyImage(galleryID, file)
+			if err != nil {
+				return fmt.Errorf("importing legacy images: %w", err)
+			}
+		}
+
+		os.Remove(dir)
 	}
 
 	return nil
 }
 
-func (gs *GalleryService) galleryDir(id int) string {
-	imagesDir := gs.ImagesDir
-	if imagesDir == "" {
-		imagesDir = DefaultImagesDir
+func (gs *GalleryService) importLegacyImage(galleryID int, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("importing %v: %w", path, err)
+	}
+	defer f.Close()
+
+	err = gs.CreateImage(galleryID, filepath.Base(path), f)
+	if err != nil {
+		var fileErr FileError
+		if errors.As(err, &fileErr) || errors.Is(err, ErrQuotaExceeded) {
+			fmt.Printf("skipping %v: %v\n", path, err)
+			return nil
+		}
+
+		return fmt.Errorf("importing %v: %w", path, err)
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return fmt.Errorf("importing %v: %w", path, err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) setImagePaths(image *Image, originalHash sql.NullString) {
+	image.Path = gs.blobPath(image.Hash)
+	if originalHash.Valid {
+		image.OriginalPath = gs.blobPath(originalHash.String)
+	}
+}
+
+func (gs *GalleryService) imagesDir() string {
+	if gs.ImagesDir == "" {
+		return DefaultImagesDir
 	}
 
-	return filepath.Join(imagesDir, fmt.Sprintf("gallery-%d", id))
+	return gs.ImagesDir
 }
 
 func (gs *GalleryService) extensions() []string {
-	return []string{".jpg", ".jpeg", ".png", ".gif"}
+	return []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
 }
 
 func (gs *GalleryService) imageContentTypes() []string {
-	return []string{"image/jpeg", "image/png", "image/gif"}
+	return []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
 }
 
 func (gs *GalleryService) sortableColumns() []string {
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// countGIFFrames walks the block structure of a GIF and counts its image
+// descriptors without decoding any pixel data. Counting stops once limit is
+// exceeded, so a huge animation is rejected without reading all of it.
+func countGIFFrames(r io.Reader, limit int) (int, error) {
+	br := bufio.NewReader(r)
+
+	var header [13]byte
+
+	_, err := io.ReadFull(br, header[:])
+	if err != nil {
+		return 0, fmt.Errorf("reading gif header: %w", err)
+	}
+
+	if string(header[:3]) != "GIF" {
+		return 0, fmt.Errorf("not a gif")
+	}
+
+	if header[10]&0x80 != 0 {
+		err = skipGIFBytes(br, 3<<(header[10]&0x07+1))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	frames := 0
+
+	for {
+		introducer, err := br.ReadByte()
+		if err != nil {
+			return frames, fmt.Errorf("reading gif block: %w", err)
+		}
+
+		switch introducer {
+		case 0x21: // extension
+			_, err = br.ReadByte()
+			if err != nil {
+				return frames, fmt.Errorf("reading gif extension: %w", err)
+			}
+
+			err = skipGIFSubBlocks(br)
+
+		case 0x2C: // image descriptor
+			frames++
+			if frames > limit {
+				return frames, nil
+			}
+
+			var descriptor [9]byte
+
+			_, err = io.ReadFull(br, descriptor[:])
+			if err != nil {
+				return frames, fmt.Errorf("reading gif image descriptor: %w", err)
+			}
+
+			if descriptor[8]&0x80 != 0 {
+				err = skipGIFBytes(br, 3<<(descriptor[8]&0x07+1))
+				if err != nil {
+					return frames, err
+				}
+			}
+
+			// LZW minimum code size, followed by the image data.
+			err = skipGIFBytes(br, 1)
+			if err == nil {
+				err = skipGIFSubBlocks(br)
+			}
+
+		case 0x3B: // trailer
+			return frames, nil
+
+		default:
+			return frames, fmt.Errorf("unknown gif block 0x%02x", introducer)
+		}
+
+		if err != nil {
+			return frames, err
+		}
+	}
+}
+
+func skipGIFSubBlocks(br *bufio.Reader) error {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return fmt.Errorf("reading gif sub-block: %w", err)
+		}
+
+		if size == 0 {
+			return nil
+		}
+
+		err = skipGIFBytes(br, int(size))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func skipGIFBytes(br *bufio.Reader, n int) error {
+	_, err := br.Discard(n)
+	if err != nil {
+		return fmt.Errorf("reading gif: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultArgon2Memory  = 64 * 1024
+	DefaultArgon2Time    = 3
+	DefaultArgon2Threads = 4
+	DefaultArgon2KeyLen  = 32
+	DefaultArgon2SaltLen = 16
+)
+
+type PasswordHasher interface {
+	Identifies(hash string) bool
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	Outdated(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (bh BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (bh BcryptHasher) Hash(password string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bh.cost())
+	if err != nil {
+		return "", fmt.Errorf("bcrypt: %w", err)
+	}
+
+	return string(hashedBytes), nil
+}
+
+func (bh BcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("bcrypt: %w", err)
+	}
+
+	return true, nil
+}
+
+func (bh BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < bh.cost()
+}
+
+func (bh BcryptHasher) cost() int {
+	if bh.Cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+
+	return min(bh.Cost, bcrypt.MaxCost)
+}
+
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (ah Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (ah Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := rand.Bytes(DefaultArgon2SaltLen)
+	if err != nil {
+		return "", fmt.Errorf("argon2id: %w", err)
+	}
+
+	params := ah.params()
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, DefaultArgon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.memory, params.time, params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (ah Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return false, fmt.Errorf("argon2id: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (ah Argon2idHasher) Outdated(hash string) bool {
+	stored, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	current := ah.params()
+
+	return stored.memory < current.memory || stored.time < current.time || stored.threads != current.threads ||
+		len(stored.key) < DefaultArgon2KeyLen
+}
+
+func (ah Argon2idHasher) params() argon2Params {
+	params := argon2Params{
+		memory:  ah.Memory,
+		time:    ah.Time,
+		threads: ah.Threads,
+	}
+
+	if params.memory == 0 {
+		params.memory = DefaultArgon2Memory
+	}
+
+	if params.time == 0 {
+		params.time = DefaultArgon2Time
+	}
+
+	if params.threads == 0 {
+		params.threads = DefaultArgon2Threads
+	}
+
+	params.memory = max(params.memory, 8*uint32(params.threads))
+
+	return params
+}
+
+func parseArgon2id(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("malformed hash")
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported version %q", parts[2])
+	}
+
+	var params argon2Params
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return nil, fmt.Errorf("malformed parameters: %w", err)
+	}
+
+	if params.time < 1 || params.threads < 1 || params.memory < 8*uint32(params.threads) {
+		return nil, fmt.Errorf("invalid parameters %q", parts[3])
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("malformed salt: %w", err)
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(params.key) == 0 {
+		return nil, fmt.Errorf("malformed key")
+	}
+
+	return &params, nil
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps the tests fast, the parameters are far below production
+// values.
+var testArgon2 = Argon2idHasher{Memory: 64, Time: 1, Threads: 1}
+
+func TestHashersRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"bcrypt", BcryptHasher{Cost: bcrypt.MinCost}},
+		{"argon2id", testArgon2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse 1")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+
+			if !tt.hasher.Identifies(hash) {
+				t.Errorf("Identifies(%q) = false, want true", hash)
+			}
+
+			ok, err := tt.hasher.Verify(hash, "correct horse 1")
+			if err != nil || !ok {
+				t.Errorf("Verify(correct) = %v, %v, want true, nil", ok, err)
+			}
+
+			ok, err = tt.hasher.Verify(hash, "correct horse 2")
+			if err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v, want false, nil", ok, err)
+			}
+
+			if tt.hasher.Outdated(hash) {
+				t.Errorf("Outdated(%q) = true, want false", hash)
+			}
+		})
+	}
+}
+
+func TestHashersIdentify(t *testing.T) {
+	bcryptHash := "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	argon2Hash := "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5"
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"bcrypt identifies bcrypt", BcryptHasher{}, bcryptHash, true},
+		{"bcrypt identifies 2b", BcryptHasher{}, "$2b$" + bcryptHash[4:], true},
+		{"bcrypt rejects argon2id", BcryptHasher{}, argon2Hash, false},
+		{"argon2id identifies argon2id", testArgon2, argon2Hash, true},
+		{"argon2id rejects bcrypt", testArgon2, bcryptHash, false},
+		{"argon2id rejects argon2i", testArgon2, "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.Identifies(tt.hash); got != tt.want {
+				t.Errorf("Identifies(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashersOutdated(t *testing.T) {
+	weakBcrypt, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weakArgon2, err := testArgon2.Hash("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"bcrypt same cost", BcryptHasher{Cost: bcrypt.MinCost}, weakBcrypt, false},
+		{"bcrypt higher cost", BcryptHasher{Cost: bcrypt.MinCost + 1}, weakBcrypt, true},
+		{"bcrypt malformed", BcryptHasher{}, "$2a$", true},
+		{"argon2id same parameters", testArgon2, weakArgon2, false},
+		{"argon2id more memory", Argon2idHasher{Memory: 128, Time: 1, Threads: 1}, weakArgon2, true},
+		{"argon2id more time", Argon2idHasher{Memory: 64, Time: 2, Threads: 1}, weakArgon2, true},
+		{"argon2id other threads", Argon2idHasher{Memory: 64, Time: 1, Threads: 2}, weakArgon2, true},
+		{"argon2id malformed", testArgon2, "$argon2id$", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.Outdated(tt.hash); got != tt.want {
+				t.Errorf("Outdated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"valid", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", false},
+		{"minimum memory per thread", "$argon2id$v=19$m=32,t=1,p=4$c2FsdHNhbHQ$a2V5a2V5a2V5", false},
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ", true},
+		{"other variant", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"old version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"zero time", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"zero threads", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"too many threads", "$argon2id$v=19$m=64,t=1,p=256$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"too little memory", "$argon2id$v=19$m=31,t=1,p=4$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"malformed parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5", true},
+		{"malformed salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5a2V5a2V5", true},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseArgon2id(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseArgon2id(%q) error = %v, wantErr %v", tt.hash, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerifyRejectsInvalidParameters(t *testing.T) {
+	// Before validation these hashes made argon2.IDKey panic on zero threads.
+	for _, hash := range []string{
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5",
+	} {
+		ok, err := testArgon2.Verify(hash, "password1")
+		if err == nil || ok {
+			t.Errorf("Verify(%q) = %v, %v, want false and an error", hash, ok, err)
+		}
+	}
+}
+
+func TestArgon2idParamsRaiseMemory(t *testing.T) {
+	hash, err := Argon2idHasher{Memory: 8, Time: 1, Threads: 4}.Hash("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(hash, "$m=32,t=1,p=4$") {
+		t.Errorf("Hash() = %q, want memory raised to 8 KiB per thread", hash)
+	}
+
+	if _, err := parseArgon2id(hash); err != nil {
+		t.Errorf("parseArgon2id: %v", err)
+	}
+}
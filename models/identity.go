@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Identity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type IdentityService struct {
+	DB *sql.DB
+}
+
+func (is *IdentityService) User(provider, subject string) (*User, error) {
+	var user User
+
+	row := is.DB.QueryRow(`
+		SELECT users.id, users.email
+		FROM user_identities
+		JOIN users ON users.id=user_identities.user_id
+		WHERE user_identities.provider=$1 AND user_identities.subject=$2`, provider, subject)
+
+	err := row.Scan(&user.ID, &user.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query user by identity: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (is *IdentityService) ByUser(userID int) ([]Identity, error) {
+	rows, err := is.DB.Query(`
+		SELECT id, provider, subject, email, created_at
+		FROM user_identities
+		WHERE user_id=$1
+		ORDER BY provider`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query identities by user: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []Identity
+
+	for rows.Next() {
+		identity := Identity{
+			UserID: userID,
+		}
+
+		err = rows.Scan(&identity.ID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query identities by user: %w", err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query identities by user: %w", err)
+	}
+
+	return identities, nil
+}
+
+func (is *IdentityService) Link(userID int, provider string, claims *OIDCClaims) error {
+	var id int
+
+	row := is.DB.QueryRow(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (provider, subject) DO
+		UPDATE
+		SET email=$4
+		WHERE user_identities.user_id=$1
+		RETURNING id`, userID, provider, claims.Subject, claims.Email)
+
+	err := row.Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrIdentityTaken
+		}
+
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			return ErrAlreadyLinked
+		}
+
+		return fmt.Errorf("linking identity: %w", err)
+	}
+
+	return nil
+}
+
+func (is *IdentityService) Unlink(userID int, provider string) error {
+	tx, err := is.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("unlinking identity: %w", err)
+	}
+	defer tx.Rollback()
+
+	var hasPassword bool
+	var others int
+
+	row := tx.QueryRow(`
+		SELECT users.password_hash <> '',
+		(SELECT COUNT(*) FROM user_identities WHERE user_id=users.id AND provider<>$2)
+		FROM users
+		WHERE users.id=$1
+		FOR UPDATE`, userID, provider)
+
+	err = row.Scan(&hasPassword, &others)
+	if err != nil {
+		return fmt.Errorf("unlinking identity: %w", err)
+	}
+
+	if !hasPassword && others == 0 {
+		return ErrLastLoginMethod
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM user_identities
+		WHERE user_id=$1 AND provider=$2`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("unlinking identity: %w", err)
+	}
+
+	err = checkAffected(result, "unlinking identity")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("unlinking identity: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/gen2brain/avif"
+	"github.com/gen2brain/webp"
+)
+
+const (
+	DefaultMaxPixels   = 50_000_000
+	DefaultJPEGQuality = 90
+	DefaultWebPQuality = 80
+	DefaultAVIFQuality = 60
+)
+
+type Rendition struct {
+	ContentType string
+	Path        string
+	Size        int64
+}
+
+type renditionEncoder func(w io.Writer, img image.Image) error
+
+var renditionEncoders = map[string]renditionEncoder{
+	"image/webp": encodeWebP,
+	"image/avif": encodeAVIF,
+}
+
+// DefaultRenditions are the formats generated for every still image. A
+// rendition is only kept when it is smaller than the served file.
+var DefaultRenditions = []string{"image/webp", "image/avif"}
+
+// ValidRendition reports whether renditions of the content type can be
+// generated.
+func ValidRendition(contentType string) bool {
+	_, ok := renditionEncoders[contentType]
+	return ok
+}
+
+type decodedImage struct {
+	format string
+	img    image.Image
+	anim   *gif.GIF
+}
+
+func (gs *GalleryService) decodeImage(r io.ReadSeeker) (*decodedImage, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, FileError{
+			Issue: fmt.Sprintf("undecodable image: %v", err),
+		}
+	}
+
+	maxPixels := gs.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, FileError{
+			Issue: fmt.Sprintf("image dimensions %dx%d exceed the limit of %d pixels", cfg.Width, cfg.Height, maxPixels),
+		}
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	decoded := decodedImage{
+		format: format,
+	}
+
+	if format == "gif" {
+		// Paletted frames take a byte per pixel, so animations get the same
+		// memory budget as a single RGBA image at the pixel limit. Frames are
+		// counted first, so oversized animations are rejected before any frame
+		// is decoded.
+		maxFrames := maxPixels * 4 / (cfg.Width * cfg.Height)
+
+		var frames int
+
+		frames, err = countGIFFrames(r, maxFrames)
+		if err != nil {
+			return nil, FileError{
+				Issue: fmt.Sprintf("undecodable image: %v", err),
+			}
+		}
+
+		if frames > maxFrames {
+			return nil, FileError{
+				Issue: fmt.Sprintf("animation has more than %d frames", maxFrames),
+			}
+		}
+
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("decoding image: %w", err)
+		}
+
+		decoded.anim, err = gif.DecodeAll(r)
+	} else {
+		decoded.img, _, err = image.Decode(r)
+	}
+
+	if err != nil {
+		return nil, FileError{
+			Issue: fmt.Sprintf("undecodable image: %v", err),
+		}
+	}
+
+	// Re-encoded copies and renditions carry no metadata, EXIF only lives on
+	// the private original, which moved and copied images share. The
+	// orientation is applied to the pixels so the copies aren't displayed
+	// sideways.
+	if format == "jpeg" {
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("decoding image: %w", err)
+		}
+
+		decoded.img = applyOrientation(decoded.img, jpegOrientation(r))
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	return &decoded, nil
+}
+
+func (di *decodedImage) encode() (*bytes.Reader, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch di.format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, di.img, &jpeg.Options{Quality: DefaultJPEGQuality})
+
+	case "png":
+		err = png.Encode(&buf, di.img)
+
+	case "gif":
+		err = gif.EncodeAll(&buf, di.anim)
+
+	case "webp":
+		err = encodeWebP(&buf, di.img)
+
+	default:
+		err = fmt.Errorf("unsupported format: %v", di.format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+func (di *decodedImage) contentType() string {
+	return "image/" + di.format
+}
+
+type tempRendition struct {
+	contentType string
+	blob        *tempBlob
+}
+
+func (gs *GalleryService) writeTempRenditions(decoded *decodedImage, servedSize int64) ([]tempRendition, error) {
+	if decoded.anim != nil {
+		return nil, nil
+	}
+
+	var renditions []tempRendition
+
+	for _, contentType := range gs.renditions() {
+		encode, ok := renditionEncoders[contentType]
+		if !ok || contentType == decoded.contentType() {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		err := encode(&buf, decoded.img)
+		if err != nil {
+			return renditions, fmt.Errorf("encoding %v rendition: %w", contentType, err)
+		}
+
+		if int64(buf.Len()) >= servedSize {
+			continue
+		}
+
+		blob, err := gs.writeTempBlob(&buf)
+		if err != nil {
+			return renditions, fmt.Errorf("writing %v rendition: %w", contentType, err)
+		}
+
+		renditions = append(renditions, tempRendition{
+			contentType: contentType,
+			blob:        blob,
+		})
+	}
+
+	return renditions, nil
+}
+
+func (gs *GalleryService) renditions() []string {
+	if gs.Renditions == nil {
+		return DefaultRenditions
+	}
+
+	return gs.Renditions
+}
+
+func encodeWebP(w io.Writer, img image.Image) error {
+	return webp.Encode(w, img, webp.Options{Quality: DefaultWebPQuality})
+}
+
+// encodeAVIF uses the fastest speed setting. Slower settings barely shrink
+// the output but take several times longer, and renditions are encoded
+// while the upload request waits.
+func encodeAVIF(w io.Writer, img image.Image) error {
+	return avif.Encode(w, img, avif.Options{Quality: DefaultAVIFQuality, Speed: 10})
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+
+	return img
+}
+
+func TestRenditionEncoders(t *testing.T) {
+	img := testImage(64, 48)
+
+	for _, contentType := range DefaultRenditions {
+		t.Run(contentType, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			err := renditionEncoders[contentType](&buf, img)
+			if err != nil {
+				t.Fatalf("encode err = %v", err)
+			}
+
+			cfg, format, err := image.DecodeConfig(&buf)
+			if err != nil {
+				t.Fatalf("DecodeConfig() err = %v", err)
+			}
+
+			if "image/"+format != contentType || cfg.Width != 64 || cfg.Height != 48 {
+				t.Errorf("DecodeConfig() = %s %dx%d, want %s 64x48", format, cfg.Width, cfg.Height, contentType)
+			}
+		})
+	}
+}
+
+func TestWriteTempRenditions(t *testing.T) {
+	gs := GalleryService{ImagesDir: t.TempDir(), Renditions: []string{"image/webp"}}
+	decoded := &decodedImage{format: "png", img: testImage(64, 48)}
+
+	renditions, err := gs.writeTempRenditions(decoded, 1<<20)
+	if err != nil {
+		t.Fatalf("writeTempRenditions() err = %v", err)
+	}
+	if len(renditions) != 1 || renditions[0].contentType != "image/webp" {
+		t.Fatalf("writeTempRenditions() = %+v, want a single webp rendition", renditions)
+	}
+
+	renditions, err = gs.writeTempRenditions(decoded, 1)
+	if err != nil {
+		t.Fatalf("writeTempRenditions() err = %v", err)
+	}
+	if len(renditions) != 0 {
+		t.Errorf("writeTempRenditions() kept %d renditions larger than the served file", len(renditions))
+	}
+}
+
+func testGIF(t *testing.T, frames int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	anim := gif.GIF{}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 10, 10), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+
+	err := gif.EncodeAll(&buf, &anim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int
+		limit  int
+		want   int
+	}{
+		{"single frame", 1, 10, 1},
+		{"animation", 5, 10, 5},
+		{"at the limit", 10, 10, 10},
+		{"over the limit", 50, 10, 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countGIFFrames(bytes.NewReader(testGIF(t, tt.frames)), tt.limit)
+			if err != nil {
+				t.Fatalf("countGIFFrames() err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("countGIFFrames() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountGIFFramesInvalid(t *testing.T) {
+	valid := testGIF(t, 3)
+
+	tests := map[string][]byte{
+		"empty":     nil,
+		"not a gif": []byte("\x89PNG\r\n\x1a\n0000000000"),
+		"truncated": valid[:len(valid)-20],
+	}
+
+	for name, data := range tests {
+		_, err := countGIFFrames(bytes.NewReader(data), 10)
+		if err == nil {
+			t.Errorf("countGIFFrames(%s) err = nil, want an error", name)
+		}
+	}
+}
+
+func TestDecodeImageRejectsLongAnimations(t *testing.T) {
+	gs := GalleryService{MaxPixels: 100}
+
+	_, err := gs.decodeImage(bytes.NewReader(testGIF(t, 4)))
+	if err != nil {
+		t.Fatalf("decodeImage() with 4 frames err = %v", err)
+	}
+
+	_, err = gs.decodeImage(bytes.NewReader(testGIF(t, 5)))
+	var fileErr FileError
+	if !errors.As(err, &fileErr) {
+		t.Errorf("decodeImage() with 5 frames err = %v, want a FileError", err)
+	}
+}
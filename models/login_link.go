@@ -0,0 +1,128 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+const (
+	DefaultLoginLinkDuration = 15 * time.Minute
+)
+
+type LoginLink struct {
+	ID           int
+	UserID       int
+	Email        string
+	Token        string
+	BrowserToken string
+	ExpiresAt    time.Time
+}
+
+type LoginLinkService struct {
+	DB            *sql.DB
+	BytesPerToken int
+	Duration      time.Duration
+}
+
+// BrowserToken returns a new token binding a login link to the browser that
+// requested it. It is issued before the email is looked up so that unknown
+// addresses get a cookie too.
+func (lls *LoginLinkService) BrowserToken() (string, error) {
+	token, err := rand.String(lls.bytesPerToken())
+	if err != nil {
+		return "", fmt.Errorf("creating browser token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (lls *LoginLinkService) Create(email, browserToken string) (*LoginLink, error) {
+	link := LoginLink{
+		Email:        strings.ToLower(strings.TrimSpace(email)),
+		BrowserToken: browserToken,
+	}
+
+	row := lls.DB.QueryRow(`
+		SELECT id FROM users WHERE email=$1`, link.Email)
+
+	err := row.Scan(&link.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("creating login link: %w", err)
+	}
+
+	link.Token, err = rand.String(lls.bytesPerToken())
+	if err != nil {
+		return nil, fmt.Errorf("creating login link: %w", err)
+	}
+
+	duration := lls.Duration
+	if duration == 0 {
+		duration = DefaultLoginLinkDuration
+	}
+	link.ExpiresAt = time.Now().Add(duration)
+
+	row = lls.DB.QueryRow(`
+		INSERT INTO login_links (user_id, token_hash, browser_hash, expires_at)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (user_id) DO
+		UPDATE
+		SET token_hash=$2, browser_hash=$3, expires_at=$4
+		RETURNING id`, link.UserID, lls.hash(link.Token), lls.hash(link.BrowserToken), link.ExpiresAt)
+
+	err = row.Scan(&link.ID)
+	if err != nil {
+		return nil, fmt.Errorf("creating login link: %w", err)
+	}
+
+	return &link, nil
+}
+
+func (lls *LoginLinkService) Consume(token, browserToken string) (*User, error) {
+	var user User
+	var expiresAt time.Time
+
+	row := lls.DB.QueryRow(`
+		DELETE FROM login_links
+		USING users
+		WHERE users.id=login_links.user_id
+		AND login_links.token_hash=$1 AND login_links.browser_hash=$2
+		RETURNING login_links.expires_at, users.id, users.email`, lls.hash(token), lls.hash(browserToken))
+
+	err := row.Scan(&expiresAt, &user.ID, &user.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("consuming login link: %w", err)
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (lls *LoginLinkService) bytesPerToken() int {
+	if lls.BytesPerToken < MinBytesPerToken {
+		return MinBytesPerToken
+	}
+
+	return lls.BytesPerToken
+}
+
+func (lls *LoginLinkService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
@@ -0,0 +1,423 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+const (
+	DefaultInvitationDuration = 7 * 24 * time.Hour
+)
+
+type Role string
+
+const (
+	RoleNone        Role = ""
+	RoleViewer      Role = "viewer"
+	RoleContributor Role = "contributor"
+	RoleEditor      Role = "editor"
+	RoleOwner       Role = "owner"
+)
+
+func Roles() []Role {
+	return []Role{RoleViewer, RoleContributor, RoleEditor, RoleOwner}
+}
+
+func ParseRole(s string) (Role, error) {
+	for _, role := range Roles() {
+		if string(role) == s {
+			return role, nil
+		}
+	}
+
+	return RoleNone, fmt.Errorf("parsing role %q: %w", s, ErrInvalidRole)
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleContributor:
+		return 2
+	case RoleEditor:
+		return 3
+	case RoleOwner:
+		return 4
+	default:
+		return 0
+	}
+}
+
+func (r Role) Includes(other Role) bool {
+	return r.rank() >= other.rank() && r != RoleNone
+}
+
+type Member struct {
+	GalleryID int
+	UserID    int
+	Email     string
+	Role      Role
+	CreatedAt time.Time
+}
+
+type Invitation struct {
+	ID        int
+	GalleryID int
+	InvitedBy int
+	Email     string
+	Role      Role
+	Token     string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type SharedGallery struct {
+	Gallery
+	Role Role
+}
+
+type MemberService struct {
+	DB            *sql.DB
+	BytesPerToken int
+	Duration      time.Duration
+}
+
+func (ms *MemberService) Role(gallery *Gallery, userID int) (Role, error) {
+	if gallery.OrganizationID == 0 && gallery.UserID == userID {
+		return RoleOwner, nil
+	}
+
+	var organizationRole OrganizationRole
+	var memberRole Role
+
+	row := ms.DB.QueryRow(`
+		SELECT
+		COALESCE((
+			SELECT role FROM organization_members
+			WHERE organization_id=$2 AND user_id=$3
+		), ''),
+		COALESCE((
+			SELECT role FROM gallery_members
+			WHERE gallery_id=$1 AND user_id=$3
+		), '')`, gallery.ID, gallery.OrganizationID, userID)
+
+	err := row.Scan(&organizationRole, &memberRole)
+	if err != nil {
+		return RoleNone, fmt.Errorf("query role: %w", err)
+	}
+
+	role := organizationRole.galleryRole()
+	if memberRole.rank() > role.rank() {
+		role = memberRole
+	}
+
+	return role, nil
+}
+
+func (ms *MemberService) IsMember(galleryID, userID int) (bool, error) {
+	var exists bool
+
+	row := ms.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM gallery_members
+			WHERE gallery_id=$1 AND user_id=$2
+		)`, galleryID, userID)
+
+	err := row.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("query membership: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (ms *MemberService) Members(galleryID int) ([]Member, error) {
+	rows, err := ms.DB.Query(`
+		SELECT gallery_members.user_id, users.email, gallery_members.role, gallery_members.created_at
+		FROM gallery_members
+		JOIN users ON users.id=gallery_members.user_id
+		WHERE gallery_members.gallery_id=$1
+		ORDER BY users.email`, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query members: %w", err)
+	}
+
+	var members []Member
+
+	for rows.Next() {
+		member := Member{
+			GalleryID: galleryID,
+		}
+
+		err = rows.Scan(&member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query members: %w", err)
+		}
+
+		members = append(members, member)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query members: %w", err)
+	}
+
+	return members, nil
+}
+
+func (ms *MemberService) Invitations(galleryID int) ([]Invitation, error) {
+	rows, err := ms.DB.Query(`
+		SELECT id, email, role, expires_at
+		FROM gallery_invitations
+		WHERE gallery_id=$1 AND expires_at > NOW()
+		ORDER BY email`, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query invitations: %w", err)
+	}
+
+	var invitations []Invitation
+
+	for rows.Next() {
+		invitation := Invitation{
+			GalleryID: galleryID,
+		}
+
+		err = rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("query invitations: %w", err)
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+func (ms *MemberService) SharedWith(userID int) ([]SharedGallery, error) {
+	rows, err := ms.DB.Query(`
+		SELECT galleries.id, galleries.user_id, galleries.title, galleries.created_at, gallery_members.role
+		FROM gallery_members
+		JOIN galleries ON galleries.id=gallery_members.gallery_id
+		WHERE gallery_members.user_id=$1 AND galleries.deleted_at IS NULL
+		ORDER BY galleries.title`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query shared galleries: %w", err)
+	}
+
+	var galleries []SharedGallery
+
+	for rows.Next() {
+		var gallery SharedGallery
+
+		err = rows.Scan(&gallery.ID, &gallery.UserID, &gallery.Title, &gallery.CreatedAt, &gallery.Role)
+		if err != nil {
+			return nil, fmt.Errorf("query shared galleries: %w", err)
+		}
+
+		galleries = append(galleries, gallery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query shared galleries: %w", err)
+	}
+
+	return galleries, nil
+}
+
+func (ms *MemberService) Invite(galleryID, invitedBy int, email string, role Role) (*Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	bytesPerToken := ms.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("creating invitation: %w", err)
+	}
+
+	duration := ms.Duration
+	if duration == 0 {
+		duration = DefaultInvitationDuration
+	}
+
+	invitation := Invitation{
+		GalleryID: galleryID,
+		InvitedBy: invitedBy,
+		Email:     email,
+		Role:      role,
+		Token:     token,
+		TokenHash: ms.hash(token),
+		ExpiresAt: time.Now().Add(duration),
+	}
+
+	row := ms.DB.QueryRow(`
+		INSERT INTO gallery_invitations (gallery_id, invited_by, email, role, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (gallery_id, email) DO
+		UPDATE
+		SET invited_by=$2, role=$4, token_hash=$5, expires_at=$6
+		RETURNING id`, invitation.GalleryID, invitation.InvitedBy, invitation.Email,
+		invitation.Role, invitation.TokenHash, invitation.ExpiresAt)
+
+	err = row.Scan(&invitation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("creating invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+func (ms *MemberService) Accept(token string, user *User) (*Invitation, error) {
+	var invitation Invitation
+	var owner bool
+
+	tx, err := ms.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT gallery_invitations.id, gallery_id, email, role, expires_at, galleries.user_id=$3
+		FROM gallery_invitations
+		JOIN galleries ON galleries.id=gallery_invitations.gallery_id
+		WHERE token_hash=$1 AND email=$2 AND expires_at > NOW()
+		FOR UPDATE OF gallery_invitations`, ms.hash(token), strings.ToLower(user.Email), user.ID)
+
+	err = row.Scan(&invitation.ID, &invitation.GalleryID, &invitation.Email, &invitation.Role, &invitation.ExpiresAt, &owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("accepting invitation: %w", ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+
+	if owner {
+		return nil, fmt.Errorf("accepting invitation: %w", ErrOwnGallery)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM gallery_invitations WHERE id=$1`, invitation.ID)
+
+	if err != nil {
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO gallery_members (gallery_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (gallery_id, user_id) DO
+		UPDATE
+		SET role=$3`, invitation.GalleryID, user.ID, invitation.Role)
+
+	if err != nil {
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+func (ms *MemberService) UpdateRole(galleryID, userID int, role Role) error {
+	result, err := ms.DB.Exec(`
+		UPDATE gallery_members
+		SET role=$3
+		WHERE gallery_id=$1 AND user_id=$2`, galleryID, userID, role)
+
+	if err != nil {
+		return fmt.Errorf("updating role: %w", err)
+	}
+
+	return checkAffected(result, "updating role")
+}
+
+func (ms *MemberService) Remove(galleryID, userID int) error {
+	_, err := ms.DB.Exec(`
+		DELETE FROM gallery_members
+		WHERE gallery_id=$1 AND user_id=$2`, galleryID, userID)
+
+	if err != nil {
+		return fmt.Errorf("removing member: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MemberService) RevokeInvitation(galleryID, id int) error {
+	_, err := ms.DB.Exec(`
+		DELETE FROM gallery_invitations
+		WHERE gallery_id=$1 AND id=$2`, galleryID, id)
+
+	if err != nil {
+		return fmt.Errorf("revoking invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MemberService) OwnerEmails(galleryID int) ([]string, error) {
+	rows, err := ms.DB.Query(`
+		SELECT users.email FROM galleries
+		JOIN users ON users.id=galleries.user_id
+		WHERE galleries.id=$1 AND galleries.organization_id IS NULL
+		UNION
+		SELECT users.email FROM galleries
+		JOIN organization_members ON organization_members.organization_id=galleries.organization_id
+		JOIN users ON users.id=organization_members.user_id
+		WHERE galleries.id=$1 AND organization_members.role='admin'
+		UNION
+		SELECT users.email FROM gallery_members
+		JOIN users ON users.id=gallery_members.user_id
+		WHERE gallery_members.gallery_id=$1 AND gallery_members.role='owner'`, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query gallery owners: %w", err)
+	}
+
+	var emails []string
+
+	for rows.Next() {
+		var email string
+
+		err = rows.Scan(&email)
+		if err != nil {
+			return nil, fmt.Errorf("query gallery owners: %w", err)
+		}
+
+		emails = append(emails, email)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query gallery owners: %w", err)
+	}
+
+	return emails, nil
+}
+
+func (ms *MemberService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
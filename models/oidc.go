@@ -0,0 +1,545 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+const (
+	oidcClockSkew       = time.Minute
+	oidcKeyRefreshDelay = time.Minute
+	oidcMaxResponse     = 1 << 20
+)
+
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Signup       bool
+	Client       *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type OIDCAuthRequest struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+	Link     bool
+}
+
+type OIDCClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	Nonce           string       `json:"nonce"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	Email           string       `json:"email"`
+	EmailVerified   oidcBool     `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	if err != nil {
+		return err
+	}
+
+	*a = many
+
+	return nil
+}
+
+type oidcBool bool
+
+func (ob *oidcBool) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(string(b), `"`) {
+	case "true":
+		*ob = true
+	default:
+		*ob = false
+	}
+
+	return nil
+}
+
+// VerifiedEmail returns the email address only when the provider verified it,
+// so an account is never matched by an address the user merely typed in.
+func (c *OIDCClaims) VerifiedEmail() (string, bool) {
+	if c.Email == "" || !bool(c.EmailVerified) {
+		return "", false
+	}
+
+	return c.Email, true
+}
+
+func NewOIDCAuthRequest(provider string, link bool) (*OIDCAuthRequest, error) {
+	req := OIDCAuthRequest{
+		Provider: provider,
+		Link:     link,
+	}
+
+	for _, value := range []*string{&req.State, &req.Nonce, &req.Verifier} {
+		b, err := rand.Bytes(32)
+		if err != nil {
+			return nil, fmt.Errorf("creating oidc request: %w", err)
+		}
+
+		*value = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return &req, nil
+}
+
+func (p *OIDCProvider) AuthCodeURL(req *OIDCAuthRequest) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", fmt.Errorf("auth code url: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(req.Verifier))
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultOIDCScopes
+	}
+
+	vals := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + vals.Encode(), nil
+}
+
+func (p *OIDCProvider) Exchange(req *OIDCAuthRequest, code string) (*OIDCClaims, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {req.Verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		httpReq.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.do(httpReq, &token)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("exchanging code: token endpoint returned %d: %s %s", status, token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("exchanging code: %w: missing id_token", ErrInvalidIDToken)
+	}
+
+	claims, err := p.Verify(token.IDToken, req.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	return claims, nil
+}
+
+func (p *OIDCProvider) Verify(rawIDToken, nonce string) (*OIDCClaims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("verifying id token: %w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	err := decodeJWTSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w: %w", ErrInvalidIDToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w: %w", ErrInvalidIDToken, err)
+	}
+
+	keys, err := p.signingKeys(header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := slices.ContainsFunc(keys, func(key crypto.PublicKey) bool {
+		return verifyJWTSignature(header.Alg, key, signed, signature)
+	})
+	if !verified {
+		return nil, fmt.Errorf("verifying id token: %w: bad signature", ErrInvalidIDToken)
+	}
+
+	var claims OIDCClaims
+
+	err = decodeJWTSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w: %w", ErrInvalidIDToken, err)
+	}
+
+	err = p.validateClaims(&claims, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w: %w", ErrInvalidIDToken, err)
+	}
+
+	claims.Email = strings.ToLower(strings.TrimSpace(claims.Email))
+
+	return &claims, nil
+}
+
+func (p *OIDCProvider) validateClaims(claims *OIDCClaims, nonce string) error {
+	now := time.Now()
+
+	switch {
+	case claims.Issuer != p.Issuer:
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case claims.Subject == "":
+		return fmt.Errorf("missing subject")
+	case !slices.Contains(claims.Audience, p.ClientID):
+		return fmt.Errorf("token was not issued for this client")
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.ClientID:
+		return fmt.Errorf("unexpected authorized party %q", claims.AuthorizedParty)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty == "":
+		return fmt.Errorf("missing authorized party")
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return fmt.Errorf("token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(oidcClockSkew)):
+		return fmt.Errorf("token issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return fmt.Errorf("nonce mismatch")
+	}
+
+	return nil
+}
+
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	var d oidcDiscovery
+
+	status, err := p.do(req, &d)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: %s returned %d", p.Issuer, status)
+	}
+
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", d.Issuer, p.Issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery: %s is missing required endpoints", p.Issuer)
+	}
+
+	p.discovery = &d
+
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) signingKeys(kid string) ([]crypto.PublicKey, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := p.matchingKeys(kid)
+	if len(keys) > 0 || time.Since(p.keysAt) < oidcKeyRefreshDelay {
+		return keys, nil
+	}
+
+	p.keys, err = p.fetchKeys(d.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keysAt = time.Now()
+
+	return p.matchingKeys(kid), nil
+}
+
+func (p *OIDCProvider) matchingKeys(kid string) []crypto.PublicKey {
+	if kid != "" {
+		key, ok := p.keys[kid]
+		if !ok {
+			return nil
+		}
+
+		return []crypto.PublicKey{key}
+	}
+
+	keys := make([]crypto.PublicKey, 0, len(p.keys))
+	for _, key := range p.keys {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (p *OIDCProvider) fetchKeys(jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequest(http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	status, err := p.do(req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching keys: %s returned %d", jwksURI, status)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	for i, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		kid := jwk.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+
+		switch jwk.Kty {
+		case "RSA":
+			n, err1 := decodeJWKInt(jwk.N)
+			e, err2 := decodeJWKInt(jwk.E)
+			if err1 != nil || err2 != nil || !e.IsInt64() {
+				continue
+			}
+
+			keys[kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := jwkCurve(jwk.Crv)
+			x, err1 := decodeJWKInt(jwk.X)
+			y, err2 := decodeJWKInt(jwk.Y)
+			if curve == nil || err1 != nil || err2 != nil {
+				continue
+			}
+
+			keys[kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	return keys, nil
+}
+
+func (p *OIDCProvider) do(req *http.Request, v any) (int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponse))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty jwk parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func jwkCurve(crv string) elliptic.Curve {
+	switch crv {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+
+	return nil
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	var hash crypto.Hash
+
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, digest, signature, nil) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+
+	return false
+}
@@ -0,0 +1,366 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testOIDCServer struct {
+	*httptest.Server
+	t      *testing.T
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	challenge string
+	claims    map[string]any
+}
+
+func newTestOIDCServer(t *testing.T) *testOIDCServer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testOIDCServer{t: t, rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "rsa",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			}, {
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, size))),
+				"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, size))),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "galaria" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(challenge[:]) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token": s.sign("RS256", "rsa", s.claims),
+		})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testOIDCServer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:         "test",
+		Issuer:       s.URL,
+		ClientID:     "galaria",
+		ClientSecret: "secret",
+		RedirectURL:  "https://galaria.test/oidc/test/callback",
+		Client:       s.Client(),
+	}
+}
+
+func (s *testOIDCServer) validClaims(nonce string) map[string]any {
+	now := time.Now()
+
+	return map[string]any{
+		"iss":            s.URL,
+		"sub":            "subject-1",
+		"aud":            "galaria",
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          "User@Example.com",
+		"email_verified": true,
+	}
+}
+
+func (s *testOIDCServer) sign(alg, kid string, claims map[string]any) string {
+	s.t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(nil, s.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(crand.Reader, s.rsaKey, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		var r, sig *big.Int
+		r, sig, err = ecdsa.Sign(crand.Reader, s.ecKey, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), sig.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCProviderDiscovery(t *testing.T) {
+	s := newTestOIDCServer(t)
+	p := s.provider()
+
+	req, err := NewOIDCAuthRequest(p.Name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthCodeURL(req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() err = %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != s.URL+"/authorize" {
+		t.Errorf("AuthCodeURL() endpoint = %q, want %q", got, s.URL+"/authorize")
+	}
+
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "galaria",
+		"redirect_uri":          p.RedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("AuthCodeURL() %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	s := newTestOIDCServer(t)
+	p := s.provider()
+	p.Issuer = s.URL + "/other"
+
+	_, err := p.AuthCodeURL(&OIDCAuthRequest{})
+	if err == nil {
+		t.Errorf("AuthCodeURL() err = nil, want an issuer mismatch error")
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	s := newTestOIDCServer(t)
+	p := s.provider()
+
+	req, err := NewOIDCAuthRequest(p.Name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	s.challenge = base64.RawURLEncoding.EncodeToString(challenge[:])
+	s.claims = s.validClaims(req.Nonce)
+
+	claims, err := p.Exchange(req, "code")
+	if err != nil {
+		t.Fatalf("Exchange() err = %v", err)
+	}
+
+	if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("Exchange() claims = %+v", claims)
+	}
+
+	wrongVerifier := *req
+	wrongVerifier.Verifier = "wrong"
+
+	_, err = p.Exchange(&wrongVerifier, "code")
+	if err == nil {
+		t.Errorf("Exchange() with the wrong PKCE verifier err = nil")
+	}
+
+	wrongNonce := *req
+	wrongNonce.Nonce = "wrong"
+
+	_, err = p.Exchange(&wrongNonce, "code")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Exchange() with the wrong nonce err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCProviderVerifySignature(t *testing.T) {
+	s := newTestOIDCServer(t)
+	p := s.provider()
+	claims := s.validClaims("nonce")
+
+	otherKey, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger := &testOIDCServer{t: t, rsaKey: otherKey, ecKey: s.ecKey}
+
+	valid := s.sign("RS256", "rsa", claims)
+	parts := strings.Split(valid, ".")
+	tampered, _ := json.Marshal(map[string]any{"iss": s.URL, "sub": "admin", "aud": "galaria", "nonce": "nonce", "exp": claims["exp"]})
+	noneHeader, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa"})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"RS256", valid, false},
+		{"PS256", s.sign("PS256", "rsa", claims), false},
+		{"ES256", s.sign("ES256", "ec", claims), false},
+		{"without kid", s.sign("RS256", "", claims), false},
+		{"unknown key", forger.sign("RS256", "rsa", claims), true},
+		{"algorithm for another key type", s.sign("ES256", "rsa", claims), true},
+		{"tampered payload", parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2], true},
+		{"alg none", base64.RawURLEncoding.EncodeToString(noneHeader) + "." + parts[1] + ".", true},
+		{"malformed", "not-a-jwt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(tt.token, "nonce")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Verify() err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderVerifyClaims(t *testing.T) {
+	s := newTestOIDCServer(t)
+	p := s.provider()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]any)
+		want   bool
+	}{
+		{"valid", func(claims map[string]any) {}, true},
+		{"audience list with azp", func(claims map[string]any) {
+			claims["aud"] = []string{"galaria", "other"}
+			claims["azp"] = "galaria"
+		}, true},
+		{"expired within skew", func(claims map[string]any) { claims["exp"] = now.Add(-30 * time.Second).Unix() }, true},
+		{"wrong issuer", func(claims map[string]any) { claims["iss"] = "https://evil.example.com" }, false},
+		{"wrong audience", func(claims map[string]any) { claims["aud"] = "other" }, false},
+		{"audience list without azp", func(claims map[string]any) { claims["aud"] = []string{"galaria", "other"} }, false},
+		{"wrong azp", func(claims map[string]any) { claims["azp"] = "other" }, false},
+		{"wrong nonce", func(claims map[string]any) { claims["nonce"] = "other" }, false},
+		{"missing nonce", func(claims map[string]any) { delete(claims, "nonce") }, false},
+		{"expired", func(claims map[string]any) { claims["exp"] = now.Add(-time.Hour).Unix() }, false},
+		{"missing exp", func(claims map[string]any) { delete(claims, "exp") }, false},
+		{"issued in the future", func(claims map[string]any) { claims["iat"] = now.Add(time.Hour).Unix() }, false},
+		{"missing subject", func(claims map[string]any) { claims["sub"] = "" }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := s.validClaims("nonce")
+			tt.modify(claims)
+
+			_, err := p.Verify(s.sign("RS256", "rsa", claims), "nonce")
+			if got := err == nil; got != tt.want {
+				t.Errorf("Verify() err = %v, want valid %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCClaimsVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantEmail string
+		wantOK    bool
+	}{
+		{"verified", `{"email":"a@example.com","email_verified":true}`, "a@example.com", true},
+		{"verified as string", `{"email":"a@example.com","email_verified":"true"}`, "a@example.com", true},
+		{"unverified", `{"email":"a@example.com","email_verified":false}`, "", false},
+		{"unverified as string", `{"email":"a@example.com","email_verified":"false"}`, "", false},
+		{"verification missing", `{"email":"a@example.com"}`, "", false},
+		{"email missing", `{"email_verified":true}`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims OIDCClaims
+
+			err := json.Unmarshal([]byte(tt.payload), &claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			email, ok := claims.VerifiedEmail()
+			if email != tt.wantEmail || ok != tt.wantOK {
+				t.Errorf("VerifiedEmail() = %q, %v, want %q, %v", email, ok, tt.wantEmail, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,566 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+type OrganizationRole string
+
+const (
+	OrgRoleAdmin  OrganizationRole = "admin"
+	OrgRoleMember OrganizationRole = "member"
+)
+
+func OrganizationRoles() []OrganizationRole {
+	return []OrganizationRole{OrgRoleMember, OrgRoleAdmin}
+}
+
+func ParseOrganizationRole(s string) (OrganizationRole, error) {
+	for _, role := range OrganizationRoles() {
+		if string(role) == s {
+			return role, nil
+		}
+	}
+
+	return "", fmt.Errorf("parsing organization role %q: %w", s, ErrInvalidRole)
+}
+
+func (r OrganizationRole) galleryRole() Role {
+	switch r {
+	case OrgRoleAdmin:
+		return RoleOwner
+	case OrgRoleMember:
+		return RoleEditor
+	default:
+		return RoleNone
+	}
+}
+
+type Organization struct {
+	ID        int
+	Name      string
+	Role      OrganizationRole
+	CreatedAt time.Time
+}
+
+type Workspace struct {
+	Organizations []Organization
+	Current       *Organization
+}
+
+func (w *Workspace) OrganizationID() int {
+	if w.Current == nil {
+		return 0
+	}
+
+	return w.Current.ID
+}
+
+type OrganizationMember struct {
+	OrganizationID int
+	UserID         int
+	Email          string
+	Role           OrganizationRole
+	CreatedAt      time.Time
+}
+
+type OrganizationInvitation struct {
+	ID             int
+	OrganizationID int
+	InvitedBy      int
+	Email          string
+	Role           OrganizationRole
+	Token          string
+	TokenHash      string
+	ExpiresAt      time.Time
+}
+
+type OrganizationService struct {
+	DB            *sql.DB
+	BytesPerToken int
+	Duration      time.Duration
+}
+
+func (orgs *OrganizationService) Create(userID int, name string) (*Organization, error) {
+	name = strings.TrimSpace(name)
+
+	tx, err := orgs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("creating organization: %w", err)
+	}
+	defer tx.Rollback()
+
+	organization := Organization{
+		Name: name,
+		Role: OrgRoleAdmin,
+	}
+
+	row := tx.QueryRow(`
+		INSERT INTO organizations (name)
+		VALUES ($1)
+		RETURNING id, created_at`, organization.Name)
+
+	err = row.Scan(&organization.ID, &organization.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("creating organization: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3)`, organization.ID, userID, organization.Role)
+
+	if err != nil {
+		return nil, fmt.Errorf("creating organization: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("creating organization: %w", err)
+	}
+
+	return &organization, nil
+}
+
+func (orgs *OrganizationService) ByID(id int) (*Organization, error) {
+	organization := Organization{
+		ID: id,
+	}
+
+	row := orgs.DB.QueryRow(`
+		SELECT name, created_at FROM organizations
+		WHERE id=$1`, organization.ID)
+
+	err := row.Scan(&organization.Name, &organization.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query organization by id: %w", err)
+	}
+
+	return &organization, nil
+}
+
+func (orgs *OrganizationService) ByUserID(userID int) ([]Organization, error) {
+	rows, err := orgs.DB.Query(`
+		SELECT organizations.id, organizations.name, organizations.created_at, organization_members.role
+		FROM organizations
+		JOIN organization_members ON organization_members.organization_id=organizations.id
+		WHERE organization_members.user_id=$1
+		ORDER BY organizations.name`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query organizations by user: %w", err)
+	}
+
+	var organizations []Organization
+
+	for rows.Next() {
+		var organization Organization
+
+		err = rows.Scan(&organization.ID, &organization.Name, &organization.CreatedAt, &organization.Role)
+		if err != nil {
+			return nil, fmt.Errorf("query organizations by user: %w", err)
+		}
+
+		organizations = append(organizations, organization)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query organizations by user: %w", err)
+	}
+
+	return organizations, nil
+}
+
+func (orgs *OrganizationService) Role(organizationID, userID int) (OrganizationRole, error) {
+	var role OrganizationRole
+
+	row := orgs.DB.QueryRow(`
+		SELECT role FROM organization_members
+		WHERE organization_id=$1 AND user_id=$2`, organizationID, userID)
+
+	err := row.Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("query organization role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (orgs *OrganizationService) Update(organization *Organization) error {
+	_, err := orgs.DB.Exec(`
+		UPDATE organizations
+		SET name=$2
+		WHERE id=$1`, organization.ID, strings.TrimSpace(organization.Name))
+
+	if err != nil {
+		return fmt.Errorf("updating organization: %w", err)
+	}
+
+	return nil
+}
+
+func (orgs *OrganizationService) Delete(id int) error {
+	_, err := orgs.DB.Exec(`
+		DELETE FROM organizations WHERE id=$1`, id)
+
+	if err != nil {
+		return fmt.Errorf("deleting organization: %w", err)
+	}
+
+	return nil
+}
+
+func (orgs *OrganizationService) Members(organizationID int) ([]OrganizationMember, error) {
+	rows, err := orgs.DB.Query(`
+		SELECT organization_members.user_id, users.email, organization_members.role, organization_members.created_at
+		FROM organization_members
+		JOIN users ON users.id=organization_members.user_id
+		WHERE organization_members.organization_id=$1
+		ORDER BY users.email`, organizationID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query organization members: %w", err)
+	}
+
+	var members []OrganizationMember
+
+	for rows.Next() {
+		member := OrganizationMember{
+			OrganizationID: organizationID,
+		}
+
+		err = rows.Scan(&member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query organization members: %w", err)
+		}
+
+		members = append(members, member)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query organization members: %w", err)
+	}
+
+	return members, nil
+}
+
+func (orgs *OrganizationService) Invitations(organizationID int) ([]OrganizationInvitation, error) {
+	rows, err := orgs.DB.Query(`
+		SELECT id, email, role, expires_at
+		FROM organization_invitations
+		WHERE organization_id=$1 AND expires_at > NOW()
+		ORDER BY email`, organizationID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query organization invitations: %w", err)
+	}
+
+	var invitations []OrganizationInvitation
+
+	for rows.Next() {
+		invitation := OrganizationInvitation{
+			OrganizationID: organizationID,
+		}
+
+		err = rows.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("query organization invitations: %w", err)
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query organization invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+func (orgs *OrganizationService) Invite(organizationID, invitedBy int, email string, role OrganizationRole) (*OrganizationInvitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	bytesPerToken := orgs.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("creating organization invitation: %w", err)
+	}
+
+	duration := orgs.Duration
+	if duration == 0 {
+		duration = DefaultInvitationDuration
+	}
+
+	invitation := OrganizationInvitation{
+		OrganizationID: organizationID,
+		InvitedBy:      invitedBy,
+		Email:          email,
+		Role:           role,
+		Token:          token,
+		TokenHash:      orgs.hash(token),
+		ExpiresAt:      time.Now().Add(duration),
+	}
+
+	row := orgs.DB.QueryRow(`
+		INSERT INTO organization_invitations (organization_id, invited_by, email, role, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (organization_id, email) DO
+		UPDATE
+		SET invited_by=$2, role=$4, token_hash=$5, expires_at=$6
+		RETURNING id`, invitation.OrganizationID, invitation.InvitedBy, invitation.Email,
+		invitation.Role, invitation.TokenHash, invitation.ExpiresAt)
+
+	err = row.Scan(&invitation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("creating organization invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+func (orgs *OrganizationService) Accept(token string, user *User) (*OrganizationInvitation, error) {
+	tx, err := orgs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("accepting organization invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	var invitation OrganizationInvitation
+
+	row := tx.QueryRow(`
+		DELETE FROM organization_invitations
+		WHERE token_hash=$1 AND email=$2 AND expires_at > NOW()
+		RETURNING id, organization_id, email, role, expires_at`, orgs.hash(token), strings.ToLower(user.Email))
+
+	err = row.Scan(&invitation.ID, &invitation.OrganizationID, &invitation.Email, &invitation.Role, &invitation.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("accepting organization invitation: %w", ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("accepting organization invitation: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, $3) ON CONFLICT (organization_id, user_id) DO NOTHING`,
+		invitation.OrganizationID, user.ID, invitation.Role)
+
+	if err != nil {
+		return nil, fmt.Errorf("accepting organization invitation: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("accepting organization invitation: %w", err)
+	}
+
+	return &invitation, nil
+}
+
+func (orgs *OrganizationService) UpdateRole(organizationID, userID int, role OrganizationRole) error {
+	tx, err := orgs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("updating organization role: %w", err)
+	}
+	defer tx.Rollback()
+
+	if role != OrgRoleAdmin {
+		err = checkLastAdmin(tx, organizationID, userID)
+		if err != nil {
+			return fmt.Errorf("updating organization role: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE organization_members
+		SET role=$3
+		WHERE organization_id=$1 AND user_id=$2`, organizationID, userID, role)
+
+	if err != nil {
+		return fmt.Errorf("updating organization role: %w", err)
+	}
+
+	err = checkAffected(result, "updating organization role")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("updating organization role: %w", err)
+	}
+
+	return nil
+}
+
+func (orgs *OrganizationService) RemoveMember(organizationID, userID int) error {
+	tx, err := orgs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("removing organization member: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = checkLastAdmin(tx, organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("removing organization member: %w", err)
+	}
+
+	err = handOverGalleries(tx, organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("removing organization member: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM organization_members
+		WHERE organization_id=$1 AND user_id=$2`, organizationID, userID)
+
+	if err != nil {
+		return fmt.Errorf("removing organization member: %w", err)
+	}
+
+	err = checkAffected(result, "removing organization member")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("removing organization member: %w", err)
+	}
+
+	return nil
+}
+
+func (orgs *OrganizationService) RevokeInvitation(organizationID, id int) error {
+	_, err := orgs.DB.Exec(`
+		DELETE FROM organization_invitations
+		WHERE organization_id=$1 AND id=$2`, organizationID, id)
+
+	if err != nil {
+		return fmt.Errorf("revoking organization invitation: %w", err)
+	}
+
+	return nil
+}
+
+// leaveOrganizations removes the user from all their organizations, handing
+// their organization galleries over to another member and deleting
+// organizations left without members.
+func leaveOrganizations(tx *sql.Tx, userID int) error {
+	organizationIDs, err := queryIDs(tx, `
+		SELECT organization_id FROM organization_members
+		WHERE user_id=$1
+		FOR UPDATE`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, organizationID := range organizationIDs {
+		_, err = tx.Exec(`
+			UPDATE organization_members
+			SET role='admin'
+			WHERE organization_id=$1 AND user_id=(
+				SELECT user_id FROM organization_members
+				WHERE organization_id=$1 AND user_id<>$2
+				ORDER BY created_at
+				LIMIT 1
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM organization_members
+				WHERE organization_id=$1 AND user_id<>$2 AND role='admin'
+			)`, organizationID, userID)
+
+		if err != nil {
+			return err
+		}
+
+		err = handOverGalleries(tx, organizationID, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM organization_members
+			WHERE organization_id=$1 AND user_id=$2`, organizationID, userID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM organizations
+			WHERE id=$1 AND NOT EXISTS (
+				SELECT 1 FROM organization_members WHERE organization_id=$1
+			)`, organizationID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (orgs *OrganizationService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
+
+func checkLastAdmin(tx *sql.Tx, organizationID, userID int) error {
+	admins, err := queryIDs(tx, `
+		SELECT user_id FROM organization_members
+		WHERE organization_id=$1 AND role='admin'
+		FOR UPDATE`, organizationID)
+
+	if err != nil {
+		return err
+	}
+
+	if len(admins) == 1 && admins[0] == userID {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+func handOverGalleries(tx *sql.Tx, organizationID, userID int) error {
+	_, err := tx.Exec(`
+		UPDATE galleries
+		SET user_id=successor.user_id
+		FROM (
+			SELECT user_id FROM organization_members
+			WHERE organization_id=$1 AND user_id<>$2
+			ORDER BY role='admin' DESC, created_at
+			LIMIT 1
+		) AS successor
+		WHERE galleries.organization_id=$1 AND galleries.user_id=$2`, organizationID, userID)
+
+	if err != nil {
+		return fmt.Errorf("handing over galleries: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMinPasswordLength = 8
+	MaxPasswordBytes         = 72
+)
+
+type PasswordError struct {
+	Issue string
+}
+
+func (pe PasswordError) Error() string {
+	return fmt.Sprintf("invalid password: %v", pe.Issue)
+}
+
+func (pe PasswordError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+	Breached  *BreachedPasswords
+}
+
+func (pp PasswordPolicy) Validate(password string) error {
+	minLength := pp.MinLength
+	if minLength <= 0 {
+		minLength = DefaultMinPasswordLength
+	}
+
+	maxBytes := pp.MaxBytes
+	if maxBytes <= 0 || maxBytes > MaxPasswordBytes {
+		maxBytes = MaxPasswordBytes
+	}
+
+	if utf8.RuneCountInString(password) < minLength {
+		return PasswordError{
+			Issue: fmt.Sprintf("passwords must be at least %d characters long", minLength),
+		}
+	}
+
+	if len(password) > maxBytes {
+		return PasswordError{
+			Issue: fmt.Sprintf("passwords can be at most %d bytes long", maxBytes),
+		}
+	}
+
+	if pp.Breached.Contains(password) {
+		return PasswordError{
+			Issue: "this password has appeared in a data breach, please choose another one",
+		}
+	}
+
+	return nil
+}
+
+// BreachedPasswords indexes SHA-1 hashes by their 5 character prefix, the same
+// split used by k-anonymity range lookups, so a file of hashes or of
+// prefix:suffix pairs can be checked without any network access.
+type BreachedPasswords struct {
+	ranges map[string][]string
+}
+
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading breached passwords: %w", err)
+	}
+	defer f.Close()
+
+	bp, err := ReadBreachedPasswords(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading breached passwords: %w", err)
+	}
+
+	return bp, nil
+}
+
+func ReadBreachedPasswords(r io.Reader) (*BreachedPasswords, error) {
+	bp := BreachedPasswords{
+		ranges: make(map[string][]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(strings.ToUpper(text), ":")
+
+		hash := fields[0]
+		if len(fields[0]) == 5 && len(fields) > 1 {
+			hash = fields[0] + fields[1]
+		}
+
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: invalid SHA-1 hash", line)
+		}
+
+		_, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid SHA-1 hash", line)
+		}
+
+		bp.ranges[hash[:5]] = append(bp.ranges[hash[:5]], hash[5:])
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for prefix, suffixes := range bp.ranges {
+		slices.Sort(suffixes)
+		bp.ranges[prefix] = slices.Compact(suffixes)
+	}
+
+	return &bp, nil
+}
+
+func (bp *BreachedPasswords) Contains(password string) bool {
+	if bp == nil {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	_, found := slices.BinarySearch(bp.ranges[hash[:5]], hash[5:])
+	return found
+}
+
+func (bp *BreachedPasswords) Len() int {
+	if bp == nil {
+		return 0
+	}
+
+	var n int
+	for _, suffixes := range bp.ranges {
+		n += len(suffixes)
+	}
+
+	return n
+}
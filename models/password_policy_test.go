@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	breached, err := ReadBreachedPasswords(strings.NewReader(
+		// SHA-1 of "password1"
+		"E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantErr  bool
+	}{
+		{"default policy", PasswordPolicy{}, "correct7horse", false},
+		{"letters and a symbol", PasswordPolicy{}, "correct-horse", false},
+		{"letters and a space", PasswordPolicy{}, "correct horse", false},
+		{"too short", PasswordPolicy{}, "abc1234", true},
+		{"counts characters not bytes", PasswordPolicy{}, "ĉĉĉĉĉĉĉ1", false},
+		{"custom minimum", PasswordPolicy{MinLength: 12}, "correct7hors", false},
+		{"under custom minimum", PasswordPolicy{MinLength: 12}, "correct7hor", true},
+		{"too long", PasswordPolicy{}, strings.Repeat("a1", 37), true},
+		{"custom maximum", PasswordPolicy{MaxBytes: 10}, "abcdefgh123", true},
+		{"maximum capped at bcrypt limit", PasswordPolicy{MaxBytes: 100}, strings.Repeat("a1", 37), true},
+		{"passphrase", PasswordPolicy{}, "correct horse battery staple", false},
+		{"only digits", PasswordPolicy{}, "1234567890", false},
+		{"breached", PasswordPolicy{Breached: breached}, "password1", true},
+		{"not breached", PasswordPolicy{Breached: breached}, "password2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("Validate(%q) error = %v, want ErrWeakPassword", tt.password, err)
+			}
+		})
+	}
+}
+
+func TestReadBreachedPasswords(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantLen int
+		wantErr bool
+	}{
+		{"full hashes", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D\nF3BBBD66A63D4BF1747940578EC3D0103530E21D\n", 2, false},
+		{"lowercase", "e38ad214943daad1d64c102faec29de4afe9da3d\n", 1, false},
+		{"prefix and suffix", "E38AD:214943DAAD1D64C102FAEC29DE4AFE9DA3D\n", 1, false},
+		{"hash with count", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:3861493\n", 1, false},
+		{"suffix with count", "E38AD:214943DAAD1D64C102FAEC29DE4AFE9DA3D:3861493\n", 1, false},
+		{"comments and blank lines", "# breached\n\n  E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D  \n", 1, false},
+		{"duplicates", "E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D\nE38AD:214943DAAD1D64C102FAEC29DE4AFE9DA3D\n", 1, false},
+		{"empty", "", 0, false},
+		{"too short", "E38AD214943DAAD1D64C\n", 0, true},
+		{"not hex", "Z38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D\n", 0, true},
+		{"plain password", "password1\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bp, err := ReadBreachedPasswords(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadBreachedPasswords error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err == nil && bp.Len() != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", bp.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestBreachedPasswordsContains(t *testing.T) {
+	bp, err := ReadBreachedPasswords(strings.NewReader(
+		"E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D\nf3bbb:d66a63d4bf1747940578ec3d0103530e21d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password1", true},
+		{"hunter2", true},
+		{"Password1", false},
+		{"letmein", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := bp.Contains(tt.password); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	var none *BreachedPasswords
+	if none.Contains("password1") || none.Len() != 0 {
+		t.Errorf("nil BreachedPasswords should be empty")
+	}
+}
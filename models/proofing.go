@@ -0,0 +1,321 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+const (
+	MaxProofingLimit   = 10000
+	MaxProofNoteLength = 1000
+)
+
+type ProofImage struct {
+	ImageID  int
+	Filename string
+	Note     string
+}
+
+type ProofSelection struct {
+	ID          int
+	GalleryID   int
+	UserID      int
+	Email       string
+	Images      []ProofImage
+	SubmittedAt time.Time
+	UpdatedAt   time.Time
+}
+
+func (ps ProofSelection) Submitted() bool {
+	return !ps.SubmittedAt.IsZero()
+}
+
+type ProofingService struct {
+	DB *sql.DB
+}
+
+func (ps *ProofingService) Configure(galleryID int, enabled bool, limit int) error {
+	if limit < 0 || limit > MaxProofingLimit {
+		return fmt.Errorf("configuring proofing: %w", ErrInvalidProofingLimit)
+	}
+
+	result, err := ps.DB.Exec(`
+		UPDATE galleries
+		SET proofing=$2, proofing_limit=$3
+		WHERE id=$1 AND deleted_at IS NULL`, galleryID, enabled, limit)
+
+	if err != nil {
+		return fmt.Errorf("configuring proofing: %w", err)
+	}
+
+	return checkAffected(result, "configuring proofing")
+}
+
+func (ps *ProofingService) Selection(galleryID, userID int) (*ProofSelection, error) {
+	selections, err := ps.querySelections("proof_selections.gallery_id=$1 AND proof_selections.user_id=$2", galleryID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query proof selection: %w", err)
+	}
+
+	if len(selections) == 0 {
+		return &ProofSelection{
+			GalleryID: galleryID,
+			UserID:    userID,
+		}, nil
+	}
+
+	return &selections[0], nil
+}
+
+func (ps *ProofingService) ByID(galleryID, id int) (*ProofSelection, error) {
+	selections, err := ps.querySelections("proof_selections.gallery_id=$1 AND proof_selections.id=$2", galleryID, id)
+	if err != nil {
+		return nil, fmt.Errorf("query proof selection by id: %w", err)
+	}
+
+	if len(selections) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &selections[0], nil
+}
+
+func (ps *ProofingService) Selections(galleryID int) ([]ProofSelection, error) {
+	selections, err := ps.querySelections("proof_selections.gallery_id=$1", galleryID)
+	if err != nil {
+		return nil, fmt.Errorf("query proof selections: %w", err)
+	}
+
+	var nonEmpty []ProofSelection
+
+	for _, selection := range selections {
+		if len(selection.Images) > 0 {
+			nonEmpty = append(nonEmpty, selection)
+		}
+	}
+
+	return nonEmpty, nil
+}
+
+func (ps *ProofingService) Select(gallery *Gallery, userID int, filename, note string) error {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > MaxProofNoteLength {
+		return fmt.Errorf("selecting image: %w", ErrProofNoteTooLong)
+	}
+
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("selecting image: %w", err)
+	}
+	defer tx.Rollback()
+
+	var imageID int
+
+	row := tx.QueryRow(`
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=$2 AND NOT pending AND deleted_at IS NULL`, gallery.ID, filename)
+
+	err = row.Scan(&imageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("selecting image: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("selecting image: %w", err)
+	}
+
+	selectionID, err := reopenSelection(tx, gallery.ID, userID)
+	if err != nil {
+		return fmt.Errorf("selecting image: %w", err)
+	}
+
+	if gallery.ProofingLimit > 0 {
+		var selected int
+
+		row = tx.QueryRow(`
+			SELECT COUNT(*) FROM proof_images
+			JOIN images ON images.id=proof_images.image_id
+			WHERE proof_images.selection_id=$1 AND proof_images.image_id<>$2
+			AND images.deleted_at IS NULL`, selectionID, imageID)
+
+		err = row.Scan(&selected)
+		if err != nil {
+			return fmt.Errorf("selecting image: %w", err)
+		}
+
+		if selected >= gallery.ProofingLimit {
+			return fmt.Errorf("selecting image: %w", ErrProofingLimit)
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO proof_images (selection_id, image_id, note)
+		VALUES ($1, $2, $3) ON CONFLICT (selection_id, image_id) DO
+		UPDATE
+		SET note=$3`, selectionID, imageID, note)
+
+	if err != nil {
+		return fmt.Errorf("selecting image: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("selecting image: %w", err)
+	}
+
+	return nil
+}
+
+func (ps *ProofingService) Deselect(galleryID, userID int, filename string) error {
+	tx, err := ps.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("deselecting image: %w", err)
+	}
+	defer tx.Rollback()
+
+	selectionID, err := reopenSelection(tx, galleryID, userID)
+	if err != nil {
+		return fmt.Errorf("deselecting image: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM proof_images
+		USING images
+		WHERE images.id=proof_images.image_id
+		AND proof_images.selection_id=$1 AND images.filename=$2`, selectionID, filename)
+
+	if err != nil {
+		return fmt.Errorf("deselecting image: %w", err)
+	}
+
+	err = checkAffected(result, "deselecting image")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("deselecting image: %w", err)
+	}
+
+	return nil
+}
+
+func (ps *ProofingService) Submit(galleryID, userID int) (*ProofSelection, error) {
+	result, err := ps.DB.Exec(`
+		UPDATE proof_selections
+		SET submitted_at=NOW(), updated_at=NOW()
+		WHERE gallery_id=$1 AND user_id=$2
+		AND EXISTS (SELECT 1 FROM proof_images WHERE selection_id=proof_selections.id)`, galleryID, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("submitting selection: %w", err)
+	}
+
+	err = checkAffected(result, "submitting selection")
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.Selection(galleryID, userID)
+}
+
+func (ps *ProofingService) querySelections(condition string, args ...any) ([]ProofSelection, error) {
+	rows, err := ps.DB.Query(`
+		SELECT proof_selections.id, proof_selections.gallery_id, proof_selections.user_id, users.email,
+		proof_selections.submitted_at, proof_selections.updated_at
+		FROM proof_selections
+		JOIN users ON users.id=proof_selections.user_id
+		WHERE `+condition+`
+		ORDER BY proof_selections.submitted_at DESC NULLS LAST, proof_selections.updated_at DESC`, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var selections []ProofSelection
+	var selectionIDs []int
+
+	for rows.Next() {
+		var selection ProofSelection
+		var submittedAt sql.NullTime
+
+		err = rows.Scan(&selection.ID, &selection.GalleryID, &selection.UserID, &selection.Email,
+			&submittedAt, &selection.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		selection.SubmittedAt = submittedAt.Time
+		selections = append(selections, selection)
+		selectionIDs = append(selectionIDs, selection.ID)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selections) == 0 {
+		return nil, nil
+	}
+
+	rows, err = ps.DB.Query(`
+		SELECT proof_images.selection_id, images.id, images.filename, proof_images.note
+		FROM proof_images
+		JOIN images ON images.id=proof_images.image_id
+		WHERE proof_images.selection_id=ANY($1) AND images.deleted_at IS NULL
+		ORDER BY images.filename`, selectionIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[int][]ProofImage)
+
+	for rows.Next() {
+		var selectionID int
+		var image ProofImage
+
+		err = rows.Scan(&selectionID, &image.ImageID, &image.Filename, &image.Note)
+		if err != nil {
+			return nil, err
+		}
+
+		images[selectionID] = append(images[selectionID], image)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range selections {
+		selections[i].Images = images[selections[i].ID]
+	}
+
+	return selections, nil
+}
+
+func reopenSelection(tx *sql.Tx, galleryID, userID int) (int, error) {
+	var selectionID int
+
+	row := tx.QueryRow(`
+		INSERT INTO proof_selections (gallery_id, user_id)
+		VALUES ($1, $2) ON CONFLICT (gallery_id, user_id) DO
+		UPDATE
+		SET submitted_at=NULL, updated_at=NOW()
+		RETURNING id`, galleryID, userID)
+
+	err := row.Scan(&selectionID)
+	if err != nil {
+		return 0, err
+	}
+
+	return selectionID, nil
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type Quota struct {
+	Bytes  int64
+	Images int
+}
+
+type Usage struct {
+	Bytes  int64
+	Images int
+	Quota  Quota
+}
+
+func (u Usage) Allows(bytes int64) bool {
+	return u.allows(1, bytes)
+}
+
+func (u Usage) allows(images int, bytes int64) bool {
+	if u.Quota.Bytes > 0 && u.Bytes+bytes > u.Quota.Bytes {
+		return false
+	}
+
+	if u.Quota.Images > 0 && u.Images+images > u.Quota.Images {
+		return false
+	}
+
+	return true
+}
+
+type GalleryUsage struct {
+	Bytes  int64
+	Images int
+}
+
+func (gs *GalleryService) Usage(userID int) (*Usage, error) {
+	var usage Usage
+
+	row := gs.DB.QueryRow(`
+		SELECT COUNT(images.id), COALESCE(SUM(blobs.size), 0)
+		FROM images
+		JOIN galleries ON galleries.id=images.gallery_id
+		JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE galleries.user_id=$1
+		AND images.deleted_at IS NULL AND galleries.deleted_at IS NULL`, userID)
+
+	err := row.Scan(&usage.Images, &usage.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("usage: %w", err)
+	}
+
+	var quotaBytes, quotaImages sql.NullInt64
+
+	row = gs.DB.QueryRow(`
+		SELECT quota_bytes, quota_images FROM users WHERE id=$1`, userID)
+
+	err = row.Scan(&quotaBytes, &quotaImages)
+	if err != nil {
+		return nil, fmt.Errorf("usage: %w", err)
+	}
+
+	usage.Quota = gs.quota(quotaBytes, quotaImages)
+
+	return &usage, nil
+}
+
+func (gs *GalleryService) UsageByGallery(userID int) (map[int]GalleryUsage, error) {
+	usages, err := gs.usageByGallery("galleries.user_id=$1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("usage by gallery: %w", err)
+	}
+
+	return usages, nil
+}
+
+func (gs *GalleryService) UsageByOrganization(organizationID int) (map[int]GalleryUsage, error) {
+	usages, err := gs.usageByGallery("galleries.organization_id=$1", organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("usage by organization: %w", err)
+	}
+
+	return usages, nil
+}
+
+func (gs *GalleryService) usageByGallery(condition string, id int) (map[int]GalleryUsage, error) {
+	rows, err := gs.DB.Query(`
+		SELECT galleries.id, COUNT(images.id), COALESCE(SUM(blobs.size), 0)
+		FROM galleries
+		JOIN images ON images.gallery_id=galleries.id
+		JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE `+condition+`
+		AND images.deleted_at IS NULL AND galleries.deleted_at IS NULL
+		GROUP BY galleries.id`, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[int]GalleryUsage)
+
+	for rows.Next() {
+		var galleryID int
+		var usage GalleryUsage
+
+		err = rows.Scan(&galleryID, &usage.Images, &usage.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		usages[galleryID] = usage
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return usages, nil
+}
+
+// checkQuota locks the gallery owner's row and checks that one more image of
+// size bytes fits their quota. An existing image with the same filename is
+// left out, since it is replaced.
+func (gs *GalleryService) checkQuota(tx *sql.Tx, galleryID int, filename string, size int64) error {
+	usage, err := gs.lockUsage(tx, galleryID, filename)
+	if err != nil {
+		return fmt.Errorf("checking quota: %w", err)
+	}
+
+	if !usage.Allows(size) {
+		return fmt.Errorf("checking quota: %w", ErrQuotaExceeded)
+	}
+
+	return nil
+}
+
+// lockUsage locks the gallery owner's row and returns their usage. Trashed
+// images and galleries don't count towards the quota, restoring them is
+// checked instead.
+func (gs *GalleryService) lockUsage(tx *sql.Tx, galleryID int, filename string) (*Usage, error) {
+	var userID int
+	var quotaBytes, quotaImages sql.NullInt64
+
+	row := tx.QueryRow(`
+		SELECT users.id, users.quota_bytes, users.quota_images
+		FROM users
+		JOIN galleries ON galleries.user_id=users.id
+		WHERE galleries.id=$1
+		FOR UPDATE OF users`, galleryID)
+
+	err := row.Scan(&userID, &quotaBytes, &quotaImages)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := Usage{
+		Quota: gs.quota(quotaBytes, quotaImages),
+	}
+
+	row = tx.QueryRow(`
+		SELECT COUNT(images.id), COALESCE(SUM(blobs.size), 0)
+		FROM images
+		JOIN galleries ON galleries.id=images.gallery_id
+		JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE galleries.user_id=$1
+		AND images.deleted_at IS NULL AND galleries.deleted_at IS NULL
+		AND NOT (images.gallery_id=$2 AND images.filename=$3)`, userID, galleryID, filename)
+
+	err = row.Scan(&usage.Images, &usage.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+func (gs *GalleryService) quota(quotaBytes, quotaImages sql.NullInt64) Quota {
+	quota := gs.DefaultQuota
+
+	if quotaBytes.Valid {
+		quota.Bytes = quotaBytes.Int64
+	}
+
+	if quotaImages.Valid {
+		quota.Images = int(quotaImages.Int64)
+	}
+
+	return quota
+}
@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestUsageAllows(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage Usage
+		bytes int64
+		want  bool
+	}{
+		{"unlimited", Usage{Bytes: 1 << 40, Images: 1 << 20}, 1 << 30, true},
+		{"under both limits", Usage{Bytes: 100, Images: 1, Quota: Quota{Bytes: 1000, Images: 10}}, 100, true},
+		{"exactly at the byte limit", Usage{Bytes: 900, Quota: Quota{Bytes: 1000}}, 100, true},
+		{"over the byte limit", Usage{Bytes: 901, Quota: Quota{Bytes: 1000}}, 100, false},
+		{"exactly at the image limit", Usage{Images: 9, Quota: Quota{Images: 10}}, 1, true},
+		{"over the image limit", Usage{Images: 10, Quota: Quota{Images: 10}}, 1, false},
+		{"only bytes limited", Usage{Images: 1 << 20, Quota: Quota{Bytes: 1000}}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.Allows(tt.bytes); got != tt.want {
+				t.Errorf("Allows(%d) = %v, want %v", tt.bytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageAllowsSeveralImages(t *testing.T) {
+	usage := Usage{Images: 5, Bytes: 500, Quota: Quota{Images: 10, Bytes: 1000}}
+
+	if !usage.allows(5, 500) {
+		t.Errorf("allows(5, 500) = false, want true")
+	}
+	if usage.allows(6, 100) {
+		t.Errorf("allows(6, 100) = true, want false")
+	}
+	if usage.allows(1, 501) {
+		t.Errorf("allows(1, 501) = true, want false")
+	}
+}
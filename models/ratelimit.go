@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+type RateLimiter interface {
+	Take(key string, limit RateLimit) (time.Duration, error)
+	Check(key string, limit RateLimit) (time.Duration, error)
+	Reset(key string) error
+	Sweep(maxAge time.Duration) error
+}
+
+type LocalRateLimiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func NewLocalRateLimiter() *LocalRateLimiter {
+	return &LocalRateLimiter{
+		hits: make(map[string][]time.Time),
+	}
+}
+
+func (lrl *LocalRateLimiter) Take(key string, limit RateLimit) (time.Duration, error) {
+	return lrl.hit(key, limit, true), nil
+}
+
+func (lrl *LocalRateLimiter) Check(key string, limit RateLimit) (time.Duration, error) {
+	return lrl.hit(key, limit, false), nil
+}
+
+func (lrl *LocalRateLimiter) hit(key string, limit RateLimit, record bool) time.Duration {
+	lrl.mu.Lock()
+	defer lrl.mu.Unlock()
+
+	now := time.Now()
+	hits := pruneHits(lrl.hits[key], now.Add(-limit.Window))
+
+	wait := retryAfter(hits, limit, now)
+	if wait == 0 && record {
+		hits = append(hits, now)
+	}
+
+	if len(hits) == 0 {
+		delete(lrl.hits, key)
+	} else {
+		lrl.hits[key] = hits
+	}
+
+	return wait
+}
+
+func (lrl *LocalRateLimiter) Reset(key string) error {
+	lrl.mu.Lock()
+	defer lrl.mu.Unlock()
+
+	delete(lrl.hits, key)
+
+	return nil
+}
+
+func (lrl *LocalRateLimiter) Sweep(maxAge time.Duration) error {
+	lrl.mu.Lock()
+	defer lrl.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+
+	for key, hits := range lrl.hits {
+		hits = pruneHits(hits, cutoff)
+		if len(hits) == 0 {
+			delete(lrl.hits, key)
+		} else {
+			lrl.hits[key] = hits
+		}
+	}
+
+	return nil
+}
+
+type PostgresRateLimiter struct {
+	DB *sql.DB
+}
+
+func (prl *PostgresRateLimiter) Take(key string, limit RateLimit) (time.Duration, error) {
+	wait, err := prl.hit(key, limit, true)
+	if err != nil {
+		return 0, fmt.Errorf("taking rate limit: %w", err)
+	}
+
+	return wait, nil
+}
+
+func (prl *PostgresRateLimiter) Check(key string, limit RateLimit) (time.Duration, error) {
+	wait, err := prl.hit(key, limit, false)
+	if err != nil {
+		return 0, fmt.Errorf("checking rate limit: %w", err)
+	}
+
+	return wait, nil
+}
+
+func (prl *PostgresRateLimiter) hit(key string, limit RateLimit, record bool) (time.Duration, error) {
+	now := time.Now()
+
+	tx, err := prl.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM rate_limit_hits
+		WHERE key=$1 AND hit_at <= $2`, key, now.Add(-limit.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT hit_at FROM rate_limit_hits
+		WHERE key=$1
+		ORDER BY hit_at`, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var hits []time.Time
+
+	for rows.Next() {
+		var hit time.Time
+
+		err = rows.Scan(&hit)
+		if err != nil {
+			return 0, err
+		}
+
+		hits = append(hits, hit)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	wait := retryAfter(hits, limit, now)
+	if wait == 0 && record {
+		_, err = tx.Exec(`
+			INSERT INTO rate_limit_hits (key, hit_at)
+			VALUES ($1, $2)`, key, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return wait, nil
+}
+
+func (prl *PostgresRateLimiter) Reset(key string) error {
+	_, err := prl.DB.Exec(`
+		DELETE FROM rate_limit_hits WHERE key=$1`, key)
+
+	if err != nil {
+		return fmt.Errorf("resetting rate limit: %w", err)
+	}
+
+	return nil
+}
+
+func (prl *PostgresRateLimiter) Sweep(maxAge time.Duration) error {
+	_, err := prl.DB.Exec(`
+		DELETE FROM rate_limit_hits WHERE hit_at < $1`, time.Now().Add(-maxAge))
+
+	if err != nil {
+		return fmt.Errorf("sweeping rate limits: %w", err)
+	}
+
+	return nil
+}
+
+func pruneHits(hits []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+
+	return hits[i:]
+}
+
+func retryAfter(hits []time.Time, limit RateLimit, now time.Time) time.Duration {
+	if limit.Requests <= 0 || len(hits) < limit.Requests {
+		return 0
+	}
+
+	expires := hits[len(hits)-limit.Requests].Add(limit.Window)
+
+	return max(expires.Sub(now), time.Second)
+}
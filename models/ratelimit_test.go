@@ -0,0 +1,131 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalRateLimiter(t *testing.T) {
+	limit := RateLimit{Requests: 3, Window: time.Hour}
+	lrl := NewLocalRateLimiter()
+
+	for i := 0; i < limit.Requests; i++ {
+		wait, err := lrl.Take("login:1.2.3.4", limit)
+		if err != nil {
+			t.Fatalf("Take() err = %v", err)
+		}
+		if wait != 0 {
+			t.Fatalf("Take() #%d wait = %v, want 0", i+1, wait)
+		}
+	}
+
+	wait, _ := lrl.Take("login:1.2.3.4", limit)
+	if wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("Take() over the limit wait = %v, want about an hour", wait)
+	}
+
+	wait, _ = lrl.Check("login:1.2.3.4", limit)
+	if wait == 0 {
+		t.Errorf("Check() over the limit wait = 0, want > 0")
+	}
+
+	wait, _ = lrl.Take("login:5.6.7.8", limit)
+	if wait != 0 {
+		t.Errorf("Take() on another key wait = %v, want 0", wait)
+	}
+
+	lrl.Reset("login:1.2.3.4")
+
+	wait, _ = lrl.Check("login:1.2.3.4", limit)
+	if wait != 0 {
+		t.Errorf("Check() after Reset() wait = %v, want 0", wait)
+	}
+}
+
+func TestLocalRateLimiterCheckDoesNotRecord(t *testing.T) {
+	limit := RateLimit{Requests: 1, Window: time.Hour}
+	lrl := NewLocalRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		wait, _ := lrl.Check("key", limit)
+		if wait != 0 {
+			t.Fatalf("Check() #%d wait = %v, want 0", i+1, wait)
+		}
+	}
+
+	wait, _ := lrl.Take("key", limit)
+	if wait != 0 {
+		t.Errorf("Take() after Check() wait = %v, want 0", wait)
+	}
+}
+
+func TestLocalRateLimiterWindow(t *testing.T) {
+	limit := RateLimit{Requests: 1, Window: 50 * time.Millisecond}
+	lrl := NewLocalRateLimiter()
+
+	lrl.Take("key", limit)
+
+	wait, _ := lrl.Take("key", limit)
+	if wait == 0 {
+		t.Fatalf("Take() inside the window wait = 0, want > 0")
+	}
+
+	time.Sleep(2 * limit.Window)
+
+	wait, _ = lrl.Take("key", limit)
+	if wait != 0 {
+		t.Errorf("Take() after the window wait = %v, want 0", wait)
+	}
+}
+
+func TestLocalRateLimiterSweep(t *testing.T) {
+	lrl := NewLocalRateLimiter()
+	lrl.Take("old", RateLimit{Requests: 5, Window: time.Hour})
+
+	time.Sleep(10 * time.Millisecond)
+	lrl.Sweep(5 * time.Millisecond)
+
+	if _, ok := lrl.hits["old"]; ok {
+		t.Errorf("Sweep() kept hits older than maxAge")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := RateLimit{Requests: 2, Window: 10 * time.Minute}
+
+	tests := []struct {
+		name string
+		hits []time.Time
+		want time.Duration
+	}{
+		{"no hits", nil, 0},
+		{"under the limit", []time.Time{now.Add(-time.Minute)}, 0},
+		{"at the limit", []time.Time{now.Add(-4 * time.Minute), now.Add(-time.Minute)}, 6 * time.Minute},
+		{"over the limit", []time.Time{now.Add(-8 * time.Minute), now.Add(-4 * time.Minute), now.Add(-time.Minute)}, 6 * time.Minute},
+		{"at least a second", []time.Time{now.Add(-10 * time.Minute), now}, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(tt.hits, limit, now)
+			if got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := retryAfter([]time.Time{now}, RateLimit{}, now); got != 0 {
+		t.Errorf("retryAfter() with no limit = %v, want 0", got)
+	}
+}
+
+func TestPruneHits(t *testing.T) {
+	now := time.Now()
+	hits := []time.Time{now.Add(-3 * time.Minute), now.Add(-2 * time.Minute), now.Add(-time.Minute)}
+
+	got := pruneHits(hits, now.Add(-2*time.Minute))
+	if len(got) != 1 || !got[0].Equal(hits[2]) {
+		t.Errorf("pruneHits() = %v, want only the last hit", got)
+	}
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	MaxRating = 5
+)
+
+type Flag string
+
+const (
+	FlagNone   Flag = ""
+	FlagPick   Flag = "pick"
+	FlagReject Flag = "reject"
+)
+
+func Flags() []Flag {
+	return []Flag{FlagPick, FlagReject}
+}
+
+func ParseFlag(s string) (Flag, error) {
+	if s == "" || s == "none" {
+		return FlagNone, nil
+	}
+
+	for _, flag := range Flags() {
+		if string(flag) == s {
+			return flag, nil
+		}
+	}
+
+	return FlagNone, fmt.Errorf("parsing flag %q: %w", s, ErrInvalidFlag)
+}
+
+type Label string
+
+const (
+	LabelNone   Label = ""
+	LabelRed    Label = "red"
+	LabelYellow Label = "yellow"
+	LabelGreen  Label = "green"
+	LabelBlue   Label = "blue"
+	LabelPurple Label = "purple"
+)
+
+func Labels() []Label {
+	return []Label{LabelRed, LabelYellow, LabelGreen, LabelBlue, LabelPurple}
+}
+
+func ParseLabel(s string) (Label, error) {
+	if s == "" || s == "none" {
+		return LabelNone, nil
+	}
+
+	for _, label := range Labels() {
+		if string(label) == s {
+			return label, nil
+		}
+	}
+
+	return LabelNone, fmt.Errorf("parsing label %q: %w", s, ErrInvalidLabel)
+}
+
+type ImageFilter struct {
+	MinRating int
+	Flag      string
+	Label     string
+	Sort      string
+	Order     string
+}
+
+func (f ImageFilter) where(args []any) (string, []any) {
+	var conditions []string
+
+	if f.MinRating > 0 {
+		args = append(args, min(f.MinRating, MaxRating))
+		conditions = append(conditions, fmt.Sprintf("images.rating >= $%d", len(args)))
+	}
+
+	if f.Flag == "none" || slices.Contains(Flags(), Flag(f.Flag)) {
+		flag, _ := ParseFlag(f.Flag)
+		args = append(args, string(flag))
+		conditions = append(conditions, fmt.Sprintf("images.flag = $%d", len(args)))
+	}
+
+	if f.Label == "none" || slices.Contains(Labels(), Label(f.Label)) {
+		label, _ := ParseLabel(f.Label)
+		args = append(args, string(label))
+		conditions = append(conditions, fmt.Sprintf("images.label = $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+func (f ImageFilter) orderBy() string {
+	sort := strings.ToLower(f.Sort)
+	order := strings.ToUpper(f.Order)
+
+	if !slices.Contains(ImageSortColumns(), sort) {
+		sort = "created_at"
+	}
+
+	if order != "ASC" && order != "DESC" {
+		order = "DESC"
+	}
+
+	column := "images." + sort
+	switch sort {
+	case "size":
+		column = "blobs.size"
+	case "likes":
+		column = "likes"
+	}
+
+	return fmt.Sprintf("%s %s, images.id %s", column, order, order)
+}
+
+func ImageSortColumns() []string {
+	return []string{"created_at", "filename", "rating", "size", "likes"}
+}
+
+func (gs *GalleryService) RateImages(galleryID int, filenames []string, rating int) error {
+	if rating < 0 || rating > MaxRating {
+		return fmt.Errorf("rating images: %w", ErrInvalidRating)
+	}
+
+	return gs.updateCulling(galleryID, filenames, "rating", rating)
+}
+
+func (gs *GalleryService) FlagImages(galleryID int, filenames []string, flag Flag) error {
+	return gs.updateCulling(galleryID, filenames, "flag", string(flag))
+}
+
+func (gs *GalleryService) LabelImages(galleryID int, filenames []string, label Label) error {
+	return gs.updateCulling(galleryID, filenames, "label", string(label))
+}
+
+func (gs *GalleryService) updateCulling(galleryID int, filenames []string, column string, value any) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("updating image %s: %w", column, err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := lockImages(tx, galleryID, filenames)
+	if err != nil {
+		return fmt.Errorf("updating image %s: %w", column, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE images
+		SET `+column+`=$2
+		WHERE id=ANY($1)`, imageIDs, value)
+
+	if err != nil {
+		return fmt.Errorf("updating image %s: %w", column, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("updating image %s: %w", column, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImageFilterWhere(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   ImageFilter
+		args     []any
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"no filter", ImageFilter{}, []any{1}, "", []any{1}},
+		{"rating", ImageFilter{MinRating: 3}, []any{1},
+			" AND images.rating >= $2", []any{1, 3}},
+		{"rating capped", ImageFilter{MinRating: 9}, []any{1},
+			" AND images.rating >= $2", []any{1, MaxRating}},
+		{"negative rating ignored", ImageFilter{MinRating: -1}, []any{1}, "", []any{1}},
+		{"flag", ImageFilter{Flag: "pick"}, []any{1},
+			" AND images.flag = $2", []any{1, "pick"}},
+		{"no flag", ImageFilter{Flag: "none"}, []any{1},
+			" AND images.flag = $2", []any{1, ""}},
+		{"unknown flag ignored", ImageFilter{Flag: "maybe'; DROP TABLE images"}, []any{1}, "", []any{1}},
+		{"label", ImageFilter{Label: "green"}, []any{1},
+			" AND images.label = $2", []any{1, "green"}},
+		{"no label", ImageFilter{Label: "none"}, []any{1},
+			" AND images.label = $2", []any{1, ""}},
+		{"unknown label ignored", ImageFilter{Label: "orange"}, []any{1}, "", []any{1}},
+		{"combined", ImageFilter{MinRating: 2, Flag: "reject", Label: "red"}, []any{1, "x"},
+			" AND images.rating >= $3 AND images.flag = $4 AND images.label = $5", []any{1, "x", 2, "reject", "red"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.filter.where(tt.args)
+			if sql != tt.wantSQL {
+				t.Errorf("where() sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("where() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestImageFilterOrderBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ImageFilter
+		want   string
+	}{
+		{"default", ImageFilter{}, "images.created_at DESC, images.id DESC"},
+		{"ascending", ImageFilter{Order: "asc"}, "images.created_at ASC, images.id ASC"},
+		{"filename", ImageFilter{Sort: "filename", Order: "ASC"}, "images.filename ASC, images.id ASC"},
+		{"rating", ImageFilter{Sort: "Rating"}, "images.rating DESC, images.id DESC"},
+		{"size", ImageFilter{Sort: "size"}, "blobs.size DESC, images.id DESC"},
+		{"likes", ImageFilter{Sort: "likes", Order: "desc"}, "likes DESC, images.id DESC"},
+		{"unknown column", ImageFilter{Sort: "id; DROP TABLE images"}, "images.created_at DESC, images.id DESC"},
+		{"unknown order", ImageFilter{Sort: "filename", Order: "sideways"}, "images.filename DESC, images.id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.orderBy(); got != tt.want {
+				t.Errorf("orderBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
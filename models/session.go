@@ -74,18 +74,22 @@ func (ss *SessionService) Delete(token string) error {
 func (ss *SessionService) User(token string) (*User, error) {
 	tokenHash := ss.hash(token)
 	var user User
+	var avatarHash sql.NullString
 
 	row := ss.DB.QueryRow(`
-		SELECT users.id, users.email, users.password_hash
+		SELECT users.id, users.email, users.handle, users.display_name, users.bio,
+		users.avatar_hash, users.password_hash
 		FROM sessions
 		JOIN users ON users.id=sessions.user_id
 		WHERE sessions.token_hash=$1`, tokenHash)
 
-	err := row.Scan(&user.ID, &user.Email, &user.PasswordHash)
+	err := row.Scan(&user.ID, &user.Email, &user.Handle, &user.DisplayName, &user.Bio, &avatarHash, &user.PasswordHash)
 	if err != nil {
 		return nil, fmt.Errorf("user: %w", err)
 	}
 
+	user.AvatarHash = avatarHash.String
+
 	return &user, nil
 }
 
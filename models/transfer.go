@@ -0,0 +1,367 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+func (gs *GalleryService) MoveImages(fromID, toID int, filenames []string) error {
+	if fromID == toID {
+		return nil
+	}
+
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("moving images: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sameOwner bool
+
+	row := tx.QueryRow(`
+		SELECT source.user_id=target.user_id
+		FROM galleries source, galleries target
+		WHERE source.id=$1 AND target.id=$2`, fromID, toID)
+
+	err = row.Scan(&sameOwner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("moving images: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("moving images: %w", err)
+	}
+
+	for _, filename := range filenames {
+		imageID, target, err := lockTransfer(tx, fromID, toID, filename)
+		if err != nil {
+			return fmt.Errorf("moving images: %w", err)
+		}
+
+		if !sameOwner {
+			size, err := imageSize(tx, imageID)
+			if err != nil {
+				return fmt.Errorf("moving %v: %w", filename, err)
+			}
+
+			err = gs.checkQuota(tx, toID, target, size)
+			if err != nil {
+				return fmt.Errorf("moving %v: %w", filename, err)
+			}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE images
+			SET gallery_id=$2, filename=$3
+			WHERE id=$1`, imageID, toID, target)
+
+		if err != nil {
+			return fmt.Errorf("moving %v: %w", filename, err)
+		}
+
+		// Comments follow the image, proofing selections belong to the
+		// clients of the source gallery.
+		_, err = tx.Exec(`
+			UPDATE comments
+			SET gallery_id=$2
+			WHERE image_id=$1`, imageID, toID)
+
+		if err != nil {
+			return fmt.Errorf("moving %v: %w", filename, err)
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM proof_images
+			WHERE image_id=$1`, imageID)
+
+		if err != nil {
+			return fmt.Errorf("moving %v: %w", filename, err)
+		}
+	}
+
+	err = touchGalleries(tx, fromID, toID)
+	if err != nil {
+		return fmt.Errorf("moving images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("moving images: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) CopyImages(fromID, toID int, filenames []string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("copying images: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, filename := range filenames {
+		imageID, target, err := lockTransfer(tx, fromID, toID, filename)
+		if err != nil {
+			return fmt.Errorf("copying images: %w", err)
+		}
+
+		_, err = gs.copyImage(tx, imageID, toID, target)
+		if err != nil {
+			return fmt.Errorf("copying %v: %w", filename, err)
+		}
+	}
+
+	err = touchGalleries(tx, fromID, toID)
+	if err != nil {
+		return fmt.Errorf("copying images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("copying images: %w", err)
+	}
+
+	return nil
+}
+
+// lockTransfer locks the image being moved or copied and picks a filename
+// that is free in the target gallery.
+func lockTransfer(tx *sql.Tx, fromID, toID int, filename string) (int, string, error) {
+	imageID, err := lockImage(tx, fromID, filename)
+	if err != nil {
+		return 0, "", err
+	}
+
+	target, err := availableFilename(tx, toID, filename)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return imageID, target, nil
+}
+
+func (gs *GalleryService) copyImage(tx *sql.Tx, imageID, toID int, filename string) (int, error) {
+	size, err := imageSize(tx, imageID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = gs.checkQuota(tx, toID, filename, size)
+	if err != nil {
+		return 0, err
+	}
+
+	var copyID int
+
+	row := tx.QueryRow(`
+		INSERT INTO images (gallery_id, filename, caption, rating, flag, label, blob_hash, original_hash, created_at)
+		SELECT $2, $3, caption, rating, flag, label, blob_hash, original_hash, created_at
+		FROM images WHERE id=$1
+		RETURNING id`, imageID, toID, filename)
+
+	err = row.Scan(&copyID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO image_tags (image_id, tag)
+		SELECT $2, tag
+		FROM image_tags WHERE image_id=$1`, imageID, copyID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO image_renditions (image_id, content_type, blob_hash)
+		SELECT $2, content_type, blob_hash
+		FROM image_renditions WHERE image_id=$1`, imageID, copyID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	hashes, err := queryHashes(tx, `
+		SELECT blob_hash, original_hash FROM images WHERE id=$1
+		UNION ALL
+		SELECT blob_hash, NULL FROM image_renditions WHERE image_id=$1`, copyID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = retainHashes(tx, hashes...)
+	if err != nil {
+		return 0, err
+	}
+
+	return copyID, nil
+}
+
+func imageSize(tx *sql.Tx, imageID int) (int64, error) {
+	var size int64
+
+	row := tx.QueryRow(`
+		SELECT blobs.size
+		FROM images
+		JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE images.id=$1`, imageID)
+
+	err := row.Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// lockImage locks a published image, pending guest uploads can only be
+// approved or rejected.
+func lockImage(tx *sql.Tx, galleryID int, filename string) (int, error) {
+	var imageID int
+
+	row := tx.QueryRow(`
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=$2 AND NOT pending AND deleted_at IS NULL
+		FOR UPDATE`, galleryID, filename)
+
+	err := row.Scan(&imageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%v: %w", filename, ErrNotFound)
+		}
+
+		return 0, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	return imageID, nil
+}
+
+func availableFilename(tx *sql.Tx, galleryID int, filename string) (string, error) {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	candidate := filename
+
+	for i := 2; ; i++ {
+		var exists bool
+
+		row := tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM images WHERE gallery_id=$1 AND filename=$2
+			)`, galleryID, candidate)
+
+		err := row.Scan(&exists)
+		if err != nil {
+			return "", fmt.Errorf("finding available filename: %w", err)
+		}
+
+		if !exists {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+func touchGalleries(tx *sql.Tx, ids ...int) error {
+	_, err := tx.Exec(`
+		UPDATE galleries
+		SET updated_at=NOW()
+		WHERE id=ANY($1)`, ids)
+
+	if err != nil {
+		return fmt.Errorf("touching galleries: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) Duplicate(id, userID int, title string) (*Gallery, error) {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("duplicating gallery: %w", err)
+	}
+	defer tx.Rollback()
+
+	gallery := Gallery{
+		UserID: userID,
+		Title:  title,
+	}
+
+	var organizationID sql.NullInt64
+
+	// The copy stays in the source's organization only if the user belongs
+	// to it, otherwise it becomes a personal gallery.
+	row := tx.QueryRow(`
+		INSERT INTO galleries (user_id, organization_id, title, proofing, proofing_limit, comments)
+		SELECT $2, (
+			SELECT organization_id FROM organization_members
+			WHERE organization_id=galleries.organization_id AND user_id=$2
+		), $3, proofing, proofing_limit, comments
+		FROM galleries
+		WHERE id=$1 AND deleted_at IS NULL
+		RETURNING id, organization_id, proofing, proofing_limit, comments, created_at, updated_at`, id, gallery.UserID, gallery.Title)
+
+	err = row.Scan(&gallery.ID, &organizationID, &gallery.Proofing, &gallery.ProofingLimit, &gallery.Comments,
+		&gallery.CreatedAt, &gallery.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("duplicating gallery: %w", ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("duplicating gallery: %w", err)
+	}
+
+	gallery.OrganizationID = int(organizationID.Int64)
+
+	rows, err := tx.Query(`
+		SELECT id, filename FROM images
+		WHERE gallery_id=$1 AND NOT pending AND deleted_at IS NULL
+		ORDER BY created_at, id`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("duplicating gallery: %w", err)
+	}
+
+	type source struct {
+		id       int
+		filename string
+	}
+
+	var sources []source
+
+	for rows.Next() {
+		var src source
+
+		err = rows.Scan(&src.id, &src.filename)
+		if err != nil {
+			return nil, fmt.Errorf("duplicating gallery: %w", err)
+		}
+
+		sources = append(sources, src)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("duplicating gallery: %w", err)
+	}
+
+	for _, src := range sources {
+		_, err = gs.copyImage(tx, src.id, gallery.ID, src.filename)
+		if err != nil {
+			return nil, fmt.Errorf("duplicating gallery: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("duplicating gallery: %w", err)
+	}
+
+	return &gallery, nil
+}
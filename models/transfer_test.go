@@ -0,0 +1,173 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image/png"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexandru-calin/galaria/migrations"
+)
+
+// testDB connects to the database named by GALARIA_TEST_DATABASE, a pgx
+// connection string, and migrates it. Tests that need Postgres are skipped
+// when it is not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("GALARIA_TEST_DATABASE")
+	if dsn == "" {
+		t.Skip("GALARIA_TEST_DATABASE is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = MigrateFS(db, migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func testUser(t *testing.T, db *sql.DB, name string) *User {
+	t.Helper()
+
+	us := UserService{
+		DB:     db,
+		Hasher: BcryptHasher{Cost: 4},
+	}
+
+	email := fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano())
+
+	user, err := us.Create(email, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestDuplicate(t *testing.T) {
+	db := testDB(t)
+
+	gs := GalleryService{
+		DB:         db,
+		ImagesDir:  t.TempDir(),
+		Renditions: []string{},
+	}
+	orgs := OrganizationService{DB: db}
+	ps := ProofingService{DB: db}
+	cs := CommentService{DB: db}
+
+	owner := testUser(t, db, "owner")
+	member := testUser(t, db, "member")
+	outsider := testUser(t, db, "outsider")
+
+	organization, err := orgs.Create(owner.ID, "Studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO organization_members (organization_id, user_id, role)
+		VALUES ($1, $2, 'member')`, organization.ID, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := gs.Create(owner.ID, organization.ID, "Template")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, testImage(16, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gs.CreateImage(source.ID, "standard.png", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filenames := []string{"standard.png"}
+
+	for _, err := range []error{
+		ps.Configure(source.ID, true, 12),
+		cs.SetMode(source.ID, CommentsModerated),
+		gs.TagImages(source.ID, filenames, []string{"cover", "standard"}),
+		gs.CaptionImages(source.ID, filenames, "Our standard shot"),
+		gs.RateImages(source.ID, filenames, 4),
+		gs.FlagImages(source.ID, filenames, FlagPick),
+		gs.LabelImages(source.ID, filenames, LabelGreen),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name             string
+		user             *User
+		wantOrganization int
+	}{
+		{"organization member", member, organization.ID},
+		{"outsider", outsider, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duplicate, err := gs.Duplicate(source.ID, tt.user.ID, "Client")
+			if err != nil {
+				t.Fatalf("Duplicate: %v", err)
+			}
+
+			gallery, err := gs.ByID(duplicate.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gallery.UserID != tt.user.ID || gallery.Title != "Client" {
+				t.Errorf("owner, title = %d, %q, want %d, %q", gallery.UserID, gallery.Title, tt.user.ID, "Client")
+			}
+			if gallery.OrganizationID != tt.wantOrganization {
+				t.Errorf("OrganizationID = %d, want %d", gallery.OrganizationID, tt.wantOrganization)
+			}
+			if !gallery.Proofing || gallery.ProofingLimit != 12 {
+				t.Errorf("proofing = %v, %d, want true, 12", gallery.Proofing, gallery.ProofingLimit)
+			}
+			if gallery.Comments != CommentsModerated {
+				t.Errorf("Comments = %q, want %q", gallery.Comments, CommentsModerated)
+			}
+
+			images, err := gs.Images(duplicate.ID, ImageFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(images) != 1 {
+				t.Fatalf("got %d images, want 1", len(images))
+			}
+
+			image := images[0]
+			if image.Filename != "standard.png" || image.Caption != "Our standard shot" {
+				t.Errorf("filename, caption = %q, %q", image.Filename, image.Caption)
+			}
+			if !reflect.DeepEqual(image.Tags, []string{"cover", "standard"}) {
+				t.Errorf("Tags = %q, want [cover standard]", image.Tags)
+			}
+			if image.Rating != 4 || image.Flag != FlagPick || image.Label != LabelGreen {
+				t.Errorf("rating, flag, label = %d, %q, %q, want 4, pick, green", image.Rating, image.Flag, image.Label)
+			}
+		})
+	}
+}
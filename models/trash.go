@@ -0,0 +1,422 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/alexandru-calin/galaria/errors"
+)
+
+const (
+	DefaultTrashRetention = 30 * 24 * time.Hour
+)
+
+const ownedByUser = `((galleries.organization_id IS NULL AND galleries.user_id=$1)
+	OR galleries.organization_id IN (
+		SELECT organization_id FROM organization_members
+		WHERE user_id=$1 AND role='admin'
+	))`
+
+type Trash struct {
+	Galleries []Gallery
+	Images    []TrashedImage
+}
+
+type TrashedImage struct {
+	Image
+	GalleryTitle string
+}
+
+func (gs *GalleryService) Trash(userID int) (*Trash, error) {
+	var trash Trash
+
+	rows, err := gs.DB.Query(`
+		SELECT id, user_id, title, created_at, updated_at, deleted_at
+		FROM galleries
+		WHERE `+ownedByUser+` AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+
+	for rows.Next() {
+		var gallery Gallery
+
+		err = rows.Scan(&gallery.ID, &gallery.UserID, &gallery.Title, &gallery.CreatedAt, &gallery.UpdatedAt, &gallery.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query trash: %w", err)
+		}
+
+		trash.Galleries = append(trash.Galleries, gallery)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+
+	rows, err = gs.DB.Query(`
+		SELECT images.id, images.gallery_id, galleries.title, images.filename,
+		images.blob_hash, blobs.size, images.created_at, images.deleted_at
+		FROM images
+		JOIN galleries ON galleries.id=images.gallery_id
+		JOIN blobs ON blobs.hash=images.blob_hash
+		WHERE `+ownedByUser+`
+		AND galleries.deleted_at IS NULL
+		AND images.deleted_at IS NOT NULL
+		ORDER BY images.deleted_at DESC`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+
+	for rows.Next() {
+		var image TrashedImage
+
+		err = rows.Scan(&image.ID, &image.GalleryID, &image.GalleryTitle, &image.Filename,
+			&image.Hash, &image.Size, &image.CreatedAt, &image.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query trash: %w", err)
+		}
+
+		image.Path = gs.blobPath(image.Hash)
+		trash.Images = append(trash.Images, image)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query trash: %w", err)
+	}
+
+	return &trash, nil
+}
+
+func (gs *GalleryService) ExpiresAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(gs.trashRetention())
+}
+
+func (gs *GalleryService) Restore(userID, id int) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("restoring gallery: %w", err)
+	}
+	defer tx.Rollback()
+
+	var images int
+	var size int64
+
+	row := tx.QueryRow(`
+		SELECT COUNT(images.id), COALESCE(SUM(blobs.size), 0)
+		FROM galleries
+		LEFT JOIN images ON images.gallery_id=galleries.id AND images.deleted_at IS NULL
+		LEFT JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE galleries.id=$2 AND `+ownedByUser+` AND galleries.deleted_at IS NOT NULL
+		GROUP BY galleries.id`, userID, id)
+
+	err = row.Scan(&images, &size)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("restoring gallery: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("restoring gallery: %w", err)
+	}
+
+	usage, err := gs.lockUsage(tx, id, "")
+	if err != nil {
+		return fmt.Errorf("restoring gallery: %w", err)
+	}
+
+	if !usage.allows(images, size) {
+		return fmt.Errorf("restoring gallery: %w", ErrQuotaExceeded)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE galleries
+		SET deleted_at=NULL
+		WHERE id=$1 AND deleted_at IS NOT NULL`, id)
+
+	if err != nil {
+		return fmt.Errorf("restoring gallery: %w", err)
+	}
+
+	err = checkAffected(result, "restoring gallery")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("restoring gallery: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) Purge(userID, id int) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("purging gallery: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT id FROM galleries
+		WHERE id=$2 AND `+ownedByUser+` AND deleted_at IS NOT NULL
+		FOR UPDATE OF galleries`, userID, id)
+
+	err = row.Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("purging gallery: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("purging gallery: %w", err)
+	}
+
+	err = gs.purgeGallery(tx, id)
+	if err != nil {
+		return fmt.Errorf("purging gallery: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("purging gallery: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) RestoreImage(galleryID int, filename string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("restoring image: %w", err)
+	}
+	defer tx.Rollback()
+
+	var size int64
+
+	row := tx.QueryRow(`
+		SELECT blobs.size
+		FROM images
+		JOIN blobs ON blobs.hash=COALESCE(images.original_hash, images.blob_hash)
+		WHERE images.gallery_id=$1 AND images.filename=$2 AND images.deleted_at IS NOT NULL`, galleryID, filename)
+
+	err = row.Scan(&size)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("restoring image: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("restoring image: %w", err)
+	}
+
+	err = gs.checkQuota(tx, galleryID, filename, size)
+	if err != nil {
+		return fmt.Errorf("restoring image: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		UPDATE images
+		SET deleted_at=NULL
+		WHERE gallery_id=$1 AND filename=$2 AND deleted_at IS NOT NULL`, galleryID, filename)
+
+	if err != nil {
+		return fmt.Errorf("restoring image: %w", err)
+	}
+
+	err = checkAffected(result, "restoring image")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("restoring image: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) PurgeImage(galleryID int, filename string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("purging image: %w", err)
+	}
+	defer tx.Rollback()
+
+	var imageID int
+
+	row := tx.QueryRow(`
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=$2 AND deleted_at IS NOT NULL
+		FOR UPDATE`, galleryID, filename)
+
+	err = row.Scan(&imageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("purging image: %w", ErrNotFound)
+		}
+
+		return fmt.Errorf("purging image: %w", err)
+	}
+
+	err = gs.purgeImages(tx, imageID)
+	if err != nil {
+		return fmt.Errorf("purging image: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("purging image: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) PurgeExpired() (int, error) {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("purging expired trash: %w", err)
+	}
+	defer tx.Rollback()
+
+	cutoff := time.Now().Add(-gs.trashRetention())
+
+	galleryIDs, err := queryIDs(tx, `
+		SELECT id FROM galleries
+		WHERE deleted_at < $1
+		FOR UPDATE`, cutoff)
+
+	if err != nil {
+		return 0, fmt.Errorf("purging expired trash: %w", err)
+	}
+
+	for _, galleryID := range galleryIDs {
+		err = gs.purgeGallery(tx, galleryID)
+		if err != nil {
+			return 0, fmt.Errorf("purging expired trash: %w", err)
+		}
+	}
+
+	imageIDs, err := queryIDs(tx, `
+		SELECT id FROM images
+		WHERE deleted_at < $1
+		FOR UPDATE`, cutoff)
+
+	if err != nil {
+		return 0, fmt.Errorf("purging expired trash: %w", err)
+	}
+
+	err = gs.purgeImages(tx, imageIDs...)
+	if err != nil {
+		return 0, fmt.Errorf("purging expired trash: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("purging expired trash: %w", err)
+	}
+
+	return len(galleryIDs) + len(imageIDs), nil
+}
+
+func (gs *GalleryService) purgeGallery(tx *sql.Tx, id int) error {
+	imageIDs, err := queryIDs(tx, `
+		SELECT id FROM images WHERE gallery_id=$1 FOR UPDATE`, id)
+
+	if err != nil {
+		return fmt.Errorf("deleting gallery: %w", err)
+	}
+
+	err = gs.purgeImages(tx, imageIDs...)
+	if err != nil {
+		return fmt.Errorf("deleting gallery: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM galleries WHERE id=$1`, id)
+
+	if err != nil {
+		return fmt.Errorf("deleting gallery: %w", err)
+	}
+
+	return nil
+}
+
+func (gs *GalleryService) purgeImages(tx *sql.Tx, ids ...int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	renditionHashes, err := queryHashes(tx, `
+		DELETE FROM image_renditions
+		WHERE image_id=ANY($1)
+		RETURNING blob_hash`, ids)
+
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	hashes, err := queryHashes(tx, `
+		DELETE FROM images
+		WHERE id=ANY($1)
+		RETURNING blob_hash, original_hash`, ids)
+
+	if err != nil {
+		return fmt.Errorf("deleting images: %w", err)
+	}
+
+	return gs.releaseBlobs(tx, append(hashes, renditionHashes...)...)
+}
+
+func (gs *GalleryService) trashRetention() time.Duration {
+	if gs.TrashRetention <= 0 {
+		return DefaultTrashRetention
+	}
+
+	return gs.TrashRetention
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...any) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+
+	for rows.Next() {
+		var id int
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("query ids: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query ids: %w", err)
+	}
+
+	return ids, nil
+}
+
+func checkAffected(result sql.Result, action string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", action, ErrNotFound)
+	}
+
+	return nil
+}
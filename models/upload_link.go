@@ -0,0 +1,328 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexandru-calin/galaria/errors"
+	"github.com/alexandru-calin/galaria/rand"
+)
+
+const (
+	DefaultUploadLinkFiles    = 50
+	DefaultUploadLinkBytes    = 20 << 20
+	DefaultUploadLinkDuration = 7 * 24 * time.Hour
+	MaxUploadLinkFiles        = 1000
+	MaxUploadLinkBytes        = 100 << 20
+	MaxUploadLinkDuration     = 90 * 24 * time.Hour
+	MaxUploaderNameLength     = 100
+)
+
+type UploadLink struct {
+	ID        int
+	GalleryID int
+	CreatedBy int
+	Label     string
+	Token     string
+	TokenHash string
+	MaxFiles  int
+	MaxBytes  int64
+	Uploads   int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func (ul UploadLink) Remaining() int {
+	return max(0, ul.MaxFiles-ul.Uploads)
+}
+
+type UploadLinkService struct {
+	DB            *sql.DB
+	BytesPerToken int
+}
+
+func (uls *UploadLinkService) Create(galleryID, createdBy int, label string, maxFiles int, maxBytes int64, duration time.Duration) (*UploadLink, error) {
+	if maxFiles < 1 || maxFiles > MaxUploadLinkFiles ||
+		maxBytes < 1 || maxBytes > MaxUploadLinkBytes ||
+		duration <= 0 || duration > MaxUploadLinkDuration {
+		return nil, fmt.Errorf("creating upload link: %w", ErrInvalidUploadLink)
+	}
+
+	bytesPerToken := uls.BytesPerToken
+	if bytesPerToken < MinBytesPerToken {
+		bytesPerToken = MinBytesPerToken
+	}
+
+	token, err := rand.String(bytesPerToken)
+	if err != nil {
+		return nil, fmt.Errorf("creating upload link: %w", err)
+	}
+
+	link := UploadLink{
+		GalleryID: galleryID,
+		CreatedBy: createdBy,
+		Label:     strings.TrimSpace(label),
+		Token:     token,
+		TokenHash: uls.hash(token),
+		MaxFiles:  maxFiles,
+		MaxBytes:  maxBytes,
+		ExpiresAt: time.Now().Add(duration),
+	}
+
+	row := uls.DB.QueryRow(`
+		INSERT INTO upload_links (gallery_id, created_by, label, token_hash, max_files, max_bytes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`, link.GalleryID, link.CreatedBy, link.Label, link.TokenHash,
+		link.MaxFiles, link.MaxBytes, link.ExpiresAt)
+
+	err = row.Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("creating upload link: %w", err)
+	}
+
+	return &link, nil
+}
+
+func (uls *UploadLinkService) ByToken(token string) (*UploadLink, error) {
+	link := UploadLink{
+		Token:     token,
+		TokenHash: uls.hash(token),
+	}
+
+	row := uls.DB.QueryRow(`
+		SELECT upload_links.id, upload_links.gallery_id, upload_links.label, upload_links.max_files,
+		upload_links.max_bytes, upload_links.uploads, upload_links.expires_at, upload_links.created_at
+		FROM upload_links
+		JOIN galleries ON galleries.id=upload_links.gallery_id
+		WHERE upload_links.token_hash=$1
+		AND upload_links.expires_at > NOW()
+		AND galleries.deleted_at IS NULL`, link.TokenHash)
+
+	err := row.Scan(&link.ID, &link.GalleryID, &link.Label, &link.MaxFiles,
+		&link.MaxBytes, &link.Uploads, &link.ExpiresAt, &link.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query upload link by token: %w", err)
+	}
+
+	return &link, nil
+}
+
+func (uls *UploadLinkService) ByGalleryID(galleryID int) ([]UploadLink, error) {
+	rows, err := uls.DB.Query(`
+		SELECT id, label, max_files, max_bytes, uploads, expires_at, created_at
+		FROM upload_links
+		WHERE gallery_id=$1 AND expires_at > NOW()
+		ORDER BY created_at DESC`, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("query upload links: %w", err)
+	}
+
+	var links []UploadLink
+
+	for rows.Next() {
+		link := UploadLink{
+			GalleryID: galleryID,
+		}
+
+		err = rows.Scan(&link.ID, &link.Label, &link.MaxFiles, &link.MaxBytes,
+			&link.Uploads, &link.ExpiresAt, &link.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("query upload links: %w", err)
+		}
+
+		links = append(links, link)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("query upload links: %w", err)
+	}
+
+	return links, nil
+}
+
+func (uls *UploadLinkService) Delete(galleryID, id int) error {
+	_, err := uls.DB.Exec(`
+		DELETE FROM upload_links
+		WHERE gallery_id=$1 AND id=$2`, galleryID, id)
+
+	if err != nil {
+		return fmt.Errorf("deleting upload link: %w", err)
+	}
+
+	return nil
+}
+
+func (uls *UploadLinkService) hash(token string) string {
+	tokenHash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(tokenHash[:])
+}
+
+func (gs *GalleryService) CreateGuestImage(link *UploadLink, filename, uploader string, contents io.ReadSeeker) error {
+	uploader = strings.TrimSpace(uploader)
+	if utf8.RuneCountInString(uploader) > MaxUploaderNameLength {
+		uploader = string([]rune(uploader)[:MaxUploaderNameLength])
+	}
+
+	return gs.createImage(link.GalleryID, filename, contents, &guestUpload{
+		linkID:   link.ID,
+		maxBytes: link.MaxBytes,
+		uploader: uploader,
+	})
+}
+
+func (gs *GalleryService) PendingImages(galleryID int) ([]Image, error) {
+	rows, err := gs.DB.Query(`
+		SELECT images.id, images.filename, images.uploaded_by,
+		images.blob_hash, images.original_hash, blobs.size, images.created_at
+		FROM images
+		JOIN blobs ON blobs.hash=images.blob_hash
+		WHERE images.gallery_id=$1 AND images.pending AND images.deleted_at IS NULL
+		ORDER BY images.created_at, images.id`, galleryID)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting pending images: %w", err)
+	}
+
+	var images []Image
+
+	for rows.Next() {
+		image := Image{
+			GalleryID: galleryID,
+			Pending:   true,
+		}
+
+		var originalHash sql.NullString
+
+		err = rows.Scan(&image.ID, &image.Filename, &image.UploadedBy,
+			&image.Hash, &originalHash, &image.Size, &image.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("getting pending images: %w", err)
+		}
+
+		gs.setImagePaths(&image, originalHash)
+		images = append(images, image)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("getting pending images: %w", err)
+	}
+
+	return images, nil
+}
+
+func (gs *GalleryService) ApproveImages(galleryID int, filenames []string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("approving images: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := queryIDs(tx, `
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=ANY($2) AND pending
+		FOR UPDATE`, galleryID, filenames)
+
+	if err != nil {
+		return fmt.Errorf("approving images: %w", err)
+	}
+
+	if len(imageIDs) != len(filenames) {
+		return fmt.Errorf("approving images: %w", ErrNotFound)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE images
+		SET pending=FALSE
+		WHERE id=ANY($1)`, imageIDs)
+
+	if err != nil {
+		return fmt.Errorf("approving images: %w", err)
+	}
+
+	err = touchGalleries(tx, galleryID)
+	if err != nil {
+		return fmt.Errorf("approving images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("approving images: %w", err)
+	}
+
+	gs.publishImages(galleryID, filenames...)
+
+	return nil
+}
+
+func (gs *GalleryService) RejectImages(galleryID int, filenames []string) error {
+	tx, err := gs.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("rejecting images: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := queryIDs(tx, `
+		SELECT id FROM images
+		WHERE gallery_id=$1 AND filename=ANY($2) AND pending
+		FOR UPDATE`, galleryID, filenames)
+
+	if err != nil {
+		return fmt.Errorf("rejecting images: %w", err)
+	}
+
+	if len(imageIDs) != len(filenames) {
+		return fmt.Errorf("rejecting images: %w", ErrNotFound)
+	}
+
+	err = gs.purgeImages(tx, imageIDs...)
+	if err != nil {
+		return fmt.Errorf("rejecting images: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("rejecting images: %w", err)
+	}
+
+	return nil
+}
+
+type guestUpload struct {
+	linkID   int
+	maxBytes int64
+	uploader string
+}
+
+func claimUpload(tx *sql.Tx, linkID int) (int, error) {
+	var galleryID int
+
+	row := tx.QueryRow(`
+		UPDATE upload_links
+		SET uploads=uploads+1
+		WHERE id=$1 AND uploads < max_files AND expires_at > NOW()
+		RETURNING gallery_id`, linkID)
+
+	err := row.Scan(&galleryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUploadLinkExhausted
+		}
+
+		return 0, fmt.Errorf("claiming upload: %w", err)
+	}
+
+	return galleryID, nil
+}
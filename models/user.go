@@ -4,57 +4,217 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	mrand "math/rand/v2"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
-	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinHandleLength      = 3
+	MaxHandleLength      = 30
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 300
 )
 
 type User struct {
 	ID           int
 	Email        string
+	Handle       string
+	DisplayName  string
+	Bio          string
+	AvatarHash   string
 	PasswordHash string
 }
 
+func (u User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+
+	return "@" + u.Handle
+}
+
 type UserService struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Policy PasswordPolicy
+	Hasher PasswordHasher
 }
 
 func (us *UserService) Create(email, password string) (*User, error) {
 	email = strings.ToLower(email)
 
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	err := us.ValidatePassword(password)
 	if err != nil {
 		return nil, fmt.Errorf("creating user: %w", err)
 	}
 
-	passwordHash := string(hashedBytes)
+	passwordHash, err := us.hasher().Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("creating user: %w", err)
+	}
 
 	user := User{
 		Email:        email,
 		PasswordHash: passwordHash,
 	}
 
-	row := us.DB.QueryRow(`
-		INSERT INTO users (email, password_hash)
-		VALUES ($1, $2) RETURNING id`, email, passwordHash)
+	err = us.insert(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (us *UserService) CreateExternal(email string) (*User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("creating user: %w", ErrInvalidEmail)
+	}
+
+	user := User{
+		Email: email,
+	}
 
-	err = row.Scan(&user.ID)
+	err := us.insert(&user)
 	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (us *UserService) insert(user *User) error {
+	for attempt := 0; ; attempt++ {
+		user.Handle = newHandle()
+
+		row := us.DB.QueryRow(`
+			INSERT INTO users (email, handle, password_hash)
+			VALUES ($1, $2, $3) RETURNING id`, user.Email, user.Handle, user.PasswordHash)
+
+		err := row.Scan(&user.ID)
+		if err == nil {
+			return nil
+		}
+
 		var pgError *pgconn.PgError
-		if errors.As(err, &pgError) {
-			if pgError.Code == pgerrcode.UniqueViolation {
-				return nil, ErrEmailTaken
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			if pgError.ConstraintName != "users_handle_key" {
+				return ErrEmailTaken
+			}
+
+			if attempt < 5 {
+				continue
 			}
 		}
 
-		return nil, fmt.Errorf("creating user: %w", err)
+		return fmt.Errorf("creating user: %w", err)
+	}
+}
+
+func (us *UserService) ByEmail(email string) (*User, error) {
+	user := User{
+		Email: strings.ToLower(strings.TrimSpace(email)),
+	}
+
+	row := us.DB.QueryRow(`
+		SELECT id FROM users
+		WHERE email=$1`, user.Email)
+
+	err := row.Scan(&user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query user by email: %w", err)
 	}
 
 	return &user, nil
 }
 
+func (us *UserService) ByHandle(handle string) (*User, error) {
+	user := User{
+		Handle: strings.ToLower(handle),
+	}
+
+	var avatarHash sql.NullString
+
+	row := us.DB.QueryRow(`
+		SELECT id, email, display_name, bio, avatar_hash FROM users
+		WHERE handle=$1`, user.Handle)
+
+	err := row.Scan(&user.ID, &user.Email, &user.DisplayName, &user.Bio, &avatarHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("query user by handle: %w", err)
+	}
+
+	user.AvatarHash = avatarHash.String
+
+	return &user, nil
+}
+
+func (us *UserService) UpdateProfile(user *User) error {
+	user.Handle = strings.ToLower(strings.TrimSpace(user.Handle))
+	user.DisplayName = strings.TrimSpace(user.DisplayName)
+	user.Bio = strings.TrimSpace(user.Bio)
+
+	if !validHandle(user.Handle) {
+		return fmt.Errorf("updating profile: %w", ErrInvalidHandle)
+	}
+
+	if utf8.RuneCountInString(user.DisplayName) > MaxDisplayNameLength || utf8.RuneCountInString(user.Bio) > MaxBioLength {
+		return fmt.Errorf("updating profile: %w", ErrProfileTooLong)
+	}
+
+	_, err := us.DB.Exec(`
+		UPDATE users
+		SET handle=$2, display_name=$3, bio=$4
+		WHERE id=$1`, user.ID, user.Handle, user.DisplayName, user.Bio)
+
+	if err != nil {
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) && pgError.Code == pgerrcode.UniqueViolation {
+			return fmt.Errorf("updating profile: %w", ErrHandleTaken)
+		}
+
+		return fmt.Errorf("updating profile: %w", err)
+	}
+
+	return nil
+}
+
+func validHandle(handle string) bool {
+	if len(handle) < MinHandleLength || len(handle) > MaxHandleLength {
+		return false
+	}
+
+	for _, r := range handle {
+		if !isHandleRune(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHandleRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_'
+}
+
+// newHandle returns a neutral placeholder handle. Handles are public, so they
+// are never derived from the email address; users pick their own later.
+func newHandle() string {
+	return fmt.Sprintf("user_%08d", mrand.IntN(100000000))
+}
+
 func (us *UserService) Delete(id int) error {
 	_, err := us.DB.Exec(`
 		DELETE FROM users WHERE id=$1`, id)
@@ -85,26 +245,89 @@ func (us *UserService) Authenticate(email, password string) (*User, error) {
 		return nil, fmt.Errorf("authenticating user: %w", err)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if user.PasswordHash == "" {
+		return nil, ErrNotFound
+	}
+
+	hasher := us.hasherFor(user.PasswordHash)
+	if hasher == nil {
+		return nil, fmt.Errorf("authenticating user: unknown password hash format")
+	}
+
+	ok, err := hasher.Verify(user.PasswordHash, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return nil, ErrNotFound
-		}
 		return nil, fmt.Errorf("authenticating user: %w", err)
 	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	preferred := us.hasher()
+	if !preferred.Identifies(user.PasswordHash) || preferred.Outdated(user.PasswordHash) {
+		err = us.rehash(&user, password)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
 
 	return &user, nil
 }
 
+func (us *UserService) rehash(user *User, password string) error {
+	passwordHash, err := us.hasher().Hash(password)
+	if err != nil {
+		return fmt.Errorf("rehashing password: %w", err)
+	}
+
+	_, err = us.DB.Exec(`
+		UPDATE users
+		SET password_hash=$3
+		WHERE id=$1 AND password_hash=$2`, user.ID, user.PasswordHash, passwordHash)
+	if err != nil {
+		return fmt.Errorf("rehashing password: %w", err)
+	}
+
+	user.PasswordHash = passwordHash
+
+	return nil
+}
+
+func (us *UserService) hasher() PasswordHasher {
+	if us.Hasher == nil {
+		return Argon2idHasher{}
+	}
+
+	return us.Hasher
+}
+
+func (us *UserService) hasherFor(hash string) PasswordHasher {
+	for _, hasher := range []PasswordHasher{us.hasher(), Argon2idHasher{}, BcryptHasher{}} {
+		if hasher.Identifies(hash) {
+			return hasher
+		}
+	}
+
+	return nil
+}
+
 func (us *UserService) UpdatePassword(userID int, password string) error {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	err := us.ValidatePassword(password)
 	if err != nil {
 		return fmt.Errorf("updating password: %w", err)
 	}
 
-	passwordHash := string(hashedBytes)
+	passwordHash, err := us.hasher().Hash(password)
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
 
-	_, err = us.DB.Exec(`
+	tx, err := us.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		UPDATE users
 		SET password_hash=$2
 		WHERE id=$1`, userID, passwordHash)
@@ -112,5 +335,32 @@ func (us *UserService) UpdatePassword(userID int, password string) error {
 		return fmt.Errorf("updating password: %w", err)
 	}
 
+	_, err = tx.Exec(`
+		DELETE FROM sessions WHERE user_id=$1`, userID)
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM password_resets WHERE user_id=$1`, userID)
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM login_links WHERE user_id=$1`, userID)
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
 	return nil
 }
+
+func (us *UserService) ValidatePassword(password string) error {
+	return us.Policy.Validate(password)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{"abc", true},
+		{"user_00000042", true},
+		{strings.Repeat("a", MaxHandleLength), true},
+		{"ab", false},
+		{strings.Repeat("a", MaxHandleLength+1), false},
+		{"Alice", false},
+		{"alice.smith", false},
+		{"alice-smith", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := validHandle(tt.handle); got != tt.want {
+			t.Errorf("validHandle(%q) = %v, want %v", tt.handle, got, tt.want)
+		}
+	}
+}
+
+func TestNewHandle(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		handle := newHandle()
+		if !validHandle(handle) {
+			t.Fatalf("newHandle() = %q, which is not a valid handle", handle)
+		}
+	}
+}
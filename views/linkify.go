@@ -0,0 +1,37 @@
+package views
+
+import (
+	"regexp"
+	"strings"
+)
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+type TextSegment struct {
+	Text string
+	URL  string
+}
+
+func linkify(s string) []TextSegment {
+	var segments []TextSegment
+
+	last := 0
+	for _, match := range linkPattern.FindAllStringIndex(s, -1) {
+		start, end := match[0], match[1]
+		link := strings.TrimRight(s[start:end], ".,;:!?)]}'")
+		end = start + len(link)
+
+		if start > last {
+			segments = append(segments, TextSegment{Text: s[last:start]})
+		}
+
+		segments = append(segments, TextSegment{Text: link, URL: link})
+		last = end
+	}
+
+	if last < len(s) {
+		segments = append(segments, TextSegment{Text: s[last:]})
+	}
+
+	return segments
+}
@@ -0,0 +1,59 @@
+package views
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkify(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []TextSegment
+	}{
+		{"empty", "", nil},
+		{"plain text", "no links here", []TextSegment{{Text: "no links here"}}},
+		{"only a link", "https://example.com", []TextSegment{
+			{Text: "https://example.com", URL: "https://example.com"},
+		}},
+		{"link in text", "see http://example.com/a?b=c for more", []TextSegment{
+			{Text: "see "},
+			{Text: "http://example.com/a?b=c", URL: "http://example.com/a?b=c"},
+			{Text: " for more"},
+		}},
+		{"trailing punctuation", "visit https://example.com/page.", []TextSegment{
+			{Text: "visit "},
+			{Text: "https://example.com/page", URL: "https://example.com/page"},
+			{Text: "."},
+		}},
+		{"parentheses", "(https://example.com)", []TextSegment{
+			{Text: "("},
+			{Text: "https://example.com", URL: "https://example.com"},
+			{Text: ")"},
+		}},
+		{"two links", "https://a.example, https://b.example", []TextSegment{
+			{Text: "https://a.example", URL: "https://a.example"},
+			{Text: ", "},
+			{Text: "https://b.example", URL: "https://b.example"},
+		}},
+		{"stops at markup", `<a href="https://example.com">`, []TextSegment{
+			{Text: `<a href="`},
+			{Text: "https://example.com", URL: "https://example.com"},
+			{Text: `">`},
+		}},
+		{"other schemes", "javascript:alert(1) ftp://example.com", []TextSegment{
+			{Text: "javascript:alert(1) ftp://example.com"},
+		}},
+		{"scheme must be lowercase", "HTTPS://example.com", []TextSegment{
+			{Text: "HTTPS://example.com"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkify(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("linkify(%q) = %#v, want %#v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -46,9 +46,13 @@ func ParseFS(fs fs.FS, patterns ...string) (Template, error) {
 		"currentTheme": func() error {
 			return fmt.Errorf("currentTheme not implemented")
 		},
+		"currentWorkspace": func() (*models.Workspace, error) {
+			return nil, fmt.Errorf("currentWorkspace not implemented")
+		},
 		"toggleSortOrder": func() error {
 			return fmt.Errorf("toggleSortOrder not implemented")
 		},
+		"linkify": linkify,
 	})
 
 	tpl, err := tpl.ParseFS(fs, patterns...)
@@ -111,6 +115,9 @@ func (t Template) Execute(w http.ResponseWriter, r *http.Request, data any, errs
 		"currentTheme": func() string {
 			return context.Theme(r.Context())
 		},
+		"currentWorkspace": func() *models.Workspace {
+			return context.Workspace(r.Context())
+		},
 		"toggleSortOrder": func(sort, order, column string) string {
 			if sort == column {
 				if order == "asc" {